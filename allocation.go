@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+var allocationsJson string
+
+// Allocation 一次 dataset get 分配给某个sp的全部piece
+type Allocation struct {
+	ID          int64     `json:"id"`
+	Time        time.Time `json:"time"`
+	DataSetName string    `json:"dataSetName"`
+	Org         string    `json:"org"`
+	Sp          string    `json:"sp"`
+	Client      string    `json:"client,omitempty"`
+	Pieces      []string  `json:"pieces"`
+	PieceSize   int64     `json:"pieceSize"`
+	CarSize     int64     `json:"carSize"`
+	Confirmed   bool      `json:"confirmed"`
+	// 是否使用 --override-quota 越过了配额限制
+	Override bool `json:"override,omitempty"`
+}
+
+type Allocations struct {
+	NextID int64         `json:"nextId"`
+	List   []*Allocation `json:"list"`
+}
+
+func NewAllocations() *Allocations {
+	return new(Allocations)
+}
+
+// ReadAllocationsFromFile 从JSON文件中读取Allocations结构体
+func (a *Allocations) ReadAllocationsFromFile() error {
+	return readJsonFile(allocationsJson, a)
+}
+
+// WriteAllocationsToFile 将Allocations结构体写入到JSON文件中
+func (a *Allocations) WriteAllocationsToFile() error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(allocationsJson, data, 0644)
+}
+
+// Add 分配新的ID并记录
+func (a *Allocations) Add(alloc *Allocation) {
+	a.NextID++
+	alloc.ID = a.NextID
+	a.List = append(a.List, alloc)
+}
+
+func (a *Allocations) Get(id int64) *Allocation {
+	for _, alloc := range a.List {
+		if alloc.ID == id {
+			return alloc
+		}
+	}
+	return nil
+}
+
+// Filter 返回满足条件的分配记录
+func (a *Allocations) Filter(keep func(alloc *Allocation) bool) []*Allocation {
+	var out []*Allocation
+	for _, alloc := range a.List {
+		if keep(alloc) {
+			out = append(out, alloc)
+		}
+	}
+	return out
+}
+
+// SizeSince 统计 since 之后分配给 sps 的pieceSize总和
+func (a *Allocations) SizeSince(sps []string, since time.Time) int64 {
+	var size int64
+	for _, alloc := range a.List {
+		if alloc.Time.After(since) && containsString(sps, alloc.Sp) {
+			size += alloc.PieceSize
+		}
+	}
+	return size
+}
+
+// Outstanding 统计分配给 sps 但还未确认的记录数量
+func (a *Allocations) Outstanding(sps []string) int {
+	var n int
+	for _, alloc := range a.List {
+		if !alloc.Confirmed && containsString(sps, alloc.Sp) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 执行修改的操作人，默认取 $USER
+var operator string
+
+func auditLogFile() string {
+	return path.Join(repoDir, "audit.log")
+}
+
+// auditHeadFile 记录最后一条审计记录，用于发现日志末尾的记录被删除
+func auditHeadFile() string {
+	return path.Join(repoDir, "audit.head")
+}
+
+// AuditHead 最后一条审计记录的序号和哈希
+type AuditHead struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// ReadAuditHead 读取 audit.head，没有该文件(旧仓库)时返回 nil
+func ReadAuditHead() (*AuditHead, error) {
+	data, err := os.ReadFile(auditHeadFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	head := new(AuditHead)
+	if err := json.Unmarshal(data, head); err != nil {
+		return nil, fmt.Errorf("read audit head: %w", err)
+	}
+	return head, nil
+}
+
+// RepoSummary 仓库数据的概要，记录在审计日志中
+type RepoSummary struct {
+	Orgs      int   `json:"orgs"`
+	Sps       int   `json:"sps"`
+	DataSets  int   `json:"dataSets"`
+	Pieces    int   `json:"pieces"`
+	Replicas  int   `json:"replicas"`
+	PieceSize int64 `json:"pieceSize"`
+}
+
+func SummarizeRepo(repo *Repo) *RepoSummary {
+	summary := new(RepoSummary)
+	summary.Orgs = len(repo.Users.List)
+	for _, user := range repo.Users.List {
+		summary.Sps += len(user.Providers)
+	}
+	summary.DataSets = len(repo.DataSets.List)
+	for _, dataSet := range repo.DataSets.List {
+		summary.Pieces += len(dataSet.Pieces)
+		for _, piece := range dataSet.Pieces {
+			summary.Replicas += piece.Replicas()
+			summary.PieceSize += piece.PieceSize * int64(piece.Replicas())
+		}
+	}
+	return summary
+}
+
+// AuditEntry 审计日志中的一条记录，Hash 由上一条记录的 Hash 和本条内容计算得出
+type AuditEntry struct {
+	Seq      int64     `json:"seq"`
+	Time     time.Time `json:"time"`
+	Operator string    `json:"operator"`
+	Command  string    `json:"command"`
+	Args     []string  `json:"args"`
+	Orgs     []string  `json:"orgs,omitempty"`
+	Sps      []string  `json:"sps,omitempty"`
+	DataSets []string  `json:"dataSets,omitempty"`
+	Changes  string    `json:"changes"`
+	// 是否使用 --override-quota 越过了配额限制
+	OverrideQuota bool         `json:"overrideQuota,omitempty"`
+	Before        *RepoSummary `json:"before"`
+	After         *RepoSummary `json:"after"`
+	PrevHash      string       `json:"prevHash"`
+	Hash          string       `json:"hash"`
+}
+
+func (e *AuditEntry) computeHash() (string, error) {
+	entry := *e
+	entry.Hash = ""
+	data, err := json.Marshal(&entry)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(e.PrevHash), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (e *AuditEntry) HasSp(sp string) bool {
+	return containsString(e.Sps, sp)
+}
+
+// NewAuditEntry 根据修改前后的仓库状态生成审计记录
+func NewAuditEntry(command string, args []string, before, after *Repo) *AuditEntry {
+	diff := DiffRepo(before, after)
+	entry := &AuditEntry{
+		Time:     time.Now(),
+		Operator: operator,
+		Command:  command,
+		Args:     args,
+		Changes:  diff.Summary(),
+		Before:   SummarizeRepo(before),
+		After:    SummarizeRepo(after),
+	}
+	for _, c := range diff.Orgs {
+		entry.Orgs = appendUnique(entry.Orgs, c.Org)
+		entry.Sps = appendUnique(entry.Sps, c.Before...)
+		entry.Sps = appendUnique(entry.Sps, c.After...)
+	}
+	for _, c := range diff.DataSets {
+		entry.DataSets = appendUnique(entry.DataSets, c.DataSetName)
+	}
+	for _, c := range diff.Pieces {
+		entry.DataSets = appendUnique(entry.DataSets, c.DataSetName)
+	}
+	for _, c := range diff.SpInfos {
+		entry.DataSets = appendUnique(entry.DataSets, c.DataSetName)
+		entry.Sps = appendUnique(entry.Sps, c.Sp)
+	}
+	for _, c := range diff.Allocations {
+		entry.DataSets = appendUnique(entry.DataSets, c.DataSetName)
+		entry.Sps = appendUnique(entry.Sps, c.Sp)
+	}
+	return entry
+}
+
+// AppendAudit 追加一条审计记录，只读取日志的最后一条记录来接上哈希链
+func AppendAudit(entry *AuditEntry) error {
+	last, err := lastAuditEntry()
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.Hash
+	}
+	entry.Hash, err = entry.computeHash()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(auditLogFile(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	head, err := json.Marshal(&AuditHead{Seq: entry.Seq, Hash: entry.Hash})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(auditHeadFile(), head, 0644)
+}
+
+// lastAuditEntry 从文件末尾向前读取，返回最后一条审计记录，日志为空时返回 nil
+func lastAuditEntry() (*AuditEntry, error) {
+	f, err := os.Open(auditLogFile())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := info.Size()
+	for window := int64(64 * 1024); ; window *= 2 {
+		if window > size {
+			window = size
+		}
+		buf := make([]byte, window)
+		if _, err := f.ReadAt(buf, size-window); err != nil {
+			return nil, err
+		}
+		buf = bytes.TrimRight(buf, " \t\r\n")
+		i := bytes.LastIndexByte(buf, '\n')
+		if i < 0 && window < size {
+			// 最后一条记录比窗口大，扩大窗口重新读取
+			continue
+		}
+		line := buf[i+1:]
+		if len(line) == 0 {
+			return nil, nil
+		}
+		entry := new(AuditEntry)
+		if err := json.Unmarshal(line, entry); err != nil {
+			return nil, fmt.Errorf("audit log last entry: %w", err)
+		}
+		return entry, nil
+	}
+}
+
+// ReadAuditLog 读取全部审计记录
+func ReadAuditLog() ([]*AuditEntry, error) {
+	f, err := os.Open(auditLogFile())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []*AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		entry := new(AuditEntry)
+		if err := json.Unmarshal(scanner.Bytes(), entry); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// VerifyAuditLog 校验哈希链，返回第一条被篡改的记录，并与 audit.head 比较，发现末尾的记录被删除。
+// audit.head 与日志在同一目录，同时改写两者无法发现，需要时可以另外保存 audit verify 输出的 head
+func VerifyAuditLog(entries []*AuditEntry) error {
+	var prev string
+	for i, entry := range entries {
+		if entry.Seq != int64(i) {
+			return fmt.Errorf("entry %d: expected seq %d, got %d", i, i, entry.Seq)
+		}
+		if entry.PrevHash != prev {
+			return fmt.Errorf("entry %d: prevHash does not match the previous entry", entry.Seq)
+		}
+		hash, err := entry.computeHash()
+		if err != nil {
+			return err
+		}
+		if hash != entry.Hash {
+			return fmt.Errorf("entry %d: hash mismatch, the entry has been modified", entry.Seq)
+		}
+		prev = entry.Hash
+	}
+
+	head, err := ReadAuditHead()
+	if err != nil || head == nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("audit head is entry %d but the log is empty, the log has been truncated", head.Seq)
+	}
+	last := entries[len(entries)-1]
+	switch {
+	case last.Seq < head.Seq:
+		return fmt.Errorf("audit head is entry %d but the log ends at entry %d, the log has been truncated", head.Seq, last.Seq)
+	case last.Seq > head.Seq:
+		return fmt.Errorf("audit head is entry %d but the log ends at entry %d, entries were appended without updating the head", head.Seq, last.Seq)
+	case last.Hash != head.Hash:
+		return fmt.Errorf("entry %d: hash does not match the audit head", last.Seq)
+	}
+	return nil
+}
+
+// parseSince 解析 7d、2w、36h 这样的相对时间，或者 2006-01-02 / RFC3339 格式的绝对时间
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(s, "d") || strings.HasSuffix(s, "w") {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time %s", s)
+		}
+		days := n
+		if strings.HasSuffix(s, "w") {
+			days = n * 7
+		}
+		return time.Now().AddDate(0, 0, -days), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if item != "" && !containsString(list, item) {
+			list = append(list, item)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
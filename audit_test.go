@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+// appendTestAudit 在临时仓库中追加 n 条审计记录，其中一条的参数大于 lastAuditEntry 的读取窗口
+func appendTestAudit(t *testing.T, n int) {
+	t.Helper()
+	repoDir = t.TempDir()
+	for i := 0; i < n; i++ {
+		entry := &AuditEntry{Command: "dist test", Args: []string{strings.Repeat("x", i*50*1024)}}
+		if err := AppendAudit(entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Seq != int64(i) {
+			t.Fatalf("got seq %d, want %d", entry.Seq, i)
+		}
+	}
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(t *testing.T, entries []*AuditEntry)
+		err    string
+	}{
+		{name: "intact", modify: func(t *testing.T, entries []*AuditEntry) {}},
+		{
+			name: "truncated",
+			modify: func(t *testing.T, entries []*AuditEntry) {
+				writeTestAudit(t, entries[:len(entries)-1])
+			},
+			err: "the log has been truncated",
+		},
+		{
+			name: "appended without head",
+			modify: func(t *testing.T, entries []*AuditEntry) {
+				last := entries[len(entries)-1]
+				entry := &AuditEntry{Seq: last.Seq + 1, PrevHash: last.Hash}
+				entry.Hash, _ = entry.computeHash()
+				writeTestAudit(t, append(entries, entry))
+			},
+			err: "without updating the head",
+		},
+		{
+			name: "last entry replaced",
+			modify: func(t *testing.T, entries []*AuditEntry) {
+				last := entries[len(entries)-1]
+				last.Command = "dist forged"
+				last.Hash, _ = last.computeHash()
+				writeTestAudit(t, entries)
+			},
+			err: "hash does not match the audit head",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			appendTestAudit(t, 4)
+			entries, err := ReadAuditLog()
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.modify(t, entries)
+			entries, err = ReadAuditLog()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = VerifyAuditLog(entries)
+			if c.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("expected error %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+// writeTestAudit 直接改写 audit.log，不更新 audit.head
+func writeTestAudit(t *testing.T, entries []*AuditEntry) {
+	t.Helper()
+	var lines []string
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(data))
+	}
+	if err := os.WriteFile(auditLogFile(), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,7 +7,9 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/gh-efforts/distribution/distribution"
 	"github.com/liushuochen/gotable"
 	"github.com/urfave/cli/v2"
 )
@@ -17,8 +19,16 @@ var userManager = &cli.Command{
 	Usage: "user manager",
 	Subcommands: []*cli.Command{
 		userView,
+		userShow,
 		userUpdate,
 		userDelete,
+		userQuota,
+		userAddSp,
+		userRemoveSp,
+		userMoveSp,
+		userOffboard,
+		userImport,
+		userExport,
 	},
 }
 
@@ -27,8 +37,10 @@ var dataSetManager = &cli.Command{
 	Usage: "dataset manager",
 	Subcommands: []*cli.Command{
 		datasetView,
+		datasetStats,
 		datasetUpdate,
 		datasetDelete,
+		datasetSet,
 		datasetGet,
 	},
 }
@@ -39,9 +51,54 @@ var pieceManager = &cli.Command{
 		pieceUpdate,
 		pieceDelete,
 		pieceView,
+		pieceTag,
 	},
 }
 
+var dryRunFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "compute the changes in memory and print them without writing the repo",
+	},
+	&cli.StringFlag{
+		Name:  "diff-format",
+		Usage: "dry-run output format: table or json",
+		Value: "table",
+	},
+}
+
+// commitRepo 指定 --dry-run 时只输出 before 到 after 的差异，否则先做快照再写入修改，并记录审计日志。返回是否已写入
+func commitRepo(ctx *cli.Context, before, after *Repo) (bool, error) {
+	if ctx.Bool("dry-run") {
+		return false, DiffRepo(before, after).Print(os.Stdout, ctx.String("diff-format"))
+	}
+	if jsonEqual(before, after) {
+		return true, nil
+	}
+	return true, saveRepo(ctx.Command.HelpName, os.Args[1:], ctx.Bool("override-quota"), before, after)
+}
+
+// saveRepo 保存快照后写入修改，并记录审计日志和当天的进度
+func saveRepo(command string, args []string, overrideQuota bool, before, after *Repo) error {
+	if _, err := TakeSnapshot(command); err != nil {
+		return err
+	}
+	if err := after.Save(before); err != nil {
+		return err
+	}
+	entry := NewAuditEntry(command, args, before, after)
+	entry.OverrideQuota = overrideQuota
+	for _, alloc := range after.Allocations.List {
+		if alloc.Override && before.Allocations.Get(alloc.ID) == nil {
+			entry.OverrideQuota = true
+		}
+	}
+	if err := AppendAudit(entry); err != nil {
+		return err
+	}
+	return RecordHistory(after, time.Now())
+}
+
 var userView = &cli.Command{
 	Name:  "view",
 	Usage: "view all users",
@@ -66,13 +123,19 @@ var userView = &cli.Command{
 			return nil
 		}
 
-		table, err := gotable.Create("org", "sps")
+		table, err := gotable.Create("org", "sps", "quota", "spQuotas")
 		if err != nil {
 			return err
 		}
 		for _, user := range users.List {
-			data, _ := json.Marshal(user.Sps)
-			table.AddRow([]string{user.Org, string(data)})
+			data, _ := json.Marshal(user.Sps())
+			var spQuotas []string
+			for _, p := range user.Providers {
+				if !p.Quota.IsZero() {
+					spQuotas = append(spQuotas, fmt.Sprintf("%s: %s", p.Sp, p.Quota))
+				}
+			}
+			table.AddRow([]string{user.Org, string(data), user.Quota.String(), strings.Join(spQuotas, "; ")})
 		}
 		fmt.Println(table)
 
@@ -83,7 +146,7 @@ var userView = &cli.Command{
 var userUpdate = &cli.Command{
 	Name:  "add",
 	Usage: "add user",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:     "sp",
 			Value:    "",
@@ -103,30 +166,41 @@ var userUpdate = &cli.Command{
 			Value: false,
 			Usage: "force update user,cover",
 		},
-	},
+	}, dryRunFlags...),
 	Action: func(ctx *cli.Context) error {
-		users := NewUsers()
-		err := users.ReadUsersFromFile()
+		repo, err := LoadRepo()
 		if err != nil {
 			return err
 		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+		users := repo.Users
 
-		user := new(User)
-		user.Org = ctx.String("org")
-		user.Sps = strings.Split(strings.TrimSpace(ctx.String("sp")), ",")
+		org := ctx.String("org")
+		sps := splitList(ctx.String("sp"))
+		if sps == nil {
+			sps = []string{}
+		}
 
-		if ok := users.Get(user.Org); ok != nil {
+		user := users.Get(org)
+		if user != nil {
 			if !ctx.Bool("force") {
-				return fmt.Errorf("already exist org %s, if want to update, please add --force\n", user.Org)
-			} else {
-				users.Update(user)
+				return fmt.Errorf("already exist org %s, if want to update, please add --force\n", org)
 			}
+			// 覆盖sp列表时保留org的配额，以及仍在列表中的sp的属性、状态和配额
+			user.SetSps(sps)
 		} else {
+			user = &User{Org: org}
+			user.SetSps(sps)
 			users.Add(user)
 		}
+		if err := users.Validate(); err != nil {
+			return err
+		}
 
-		err = users.WriteUsersToFile()
-		if err != nil {
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
 			return err
 		}
 		fmt.Printf("add user %s success!\n", user.Org)
@@ -138,7 +212,7 @@ var userUpdate = &cli.Command{
 var userDelete = &cli.Command{
 	Name:  "delete",
 	Usage: "delete a org",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:     "org",
 			Value:    "",
@@ -150,22 +224,24 @@ var userDelete = &cli.Command{
 			Name:  "really-do-it",
 			Usage: "must be specified for the action to take effect",
 		},
-	},
+	}, dryRunFlags...),
 	Action: func(ctx *cli.Context) error {
 		org := ctx.String("org")
-		if !ctx.Bool("really-do-it") {
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
 			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
 		}
 
-		users := NewUsers()
-		err := users.ReadUsersFromFile()
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
 		if err != nil {
 			return err
 		}
 
-		if ok := users.Delete(org); ok {
-			err = users.WriteUsersToFile()
-			if err != nil {
+		if ok := repo.Users.Delete(org); ok {
+			if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
 				return err
 			}
 			fmt.Printf("delete %s success!\n", org)
@@ -178,6 +254,100 @@ var userDelete = &cli.Command{
 	},
 }
 
+var userQuota = &cli.Command{
+	Name:  "quota",
+	Usage: "set the allocation quota of a org or one of its sps",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "org",
+			Usage:    "specify org",
+			Required: true,
+			Aliases:  []string{"u"},
+		},
+		&cli.StringFlag{
+			Name:  "sp",
+			Usage: "set the quota of this sp instead of the whole org",
+		},
+		&cli.Float64Flag{
+			Name:  "max-day",
+			Usage: "max pieceSize(TiB) allocated in 24 hours, 0 means unlimited",
+		},
+		&cli.Float64Flag{
+			Name:  "max-week",
+			Usage: "max pieceSize(TiB) allocated in 7 days, 0 means unlimited",
+		},
+		&cli.Float64Flag{
+			Name:  "max-share",
+			Usage: "max share(0-1) of a dataset's pieceSize, 0 means unlimited",
+		},
+		&cli.IntFlag{
+			Name:  "max-outstanding",
+			Usage: "max unconfirmed allocations, 0 means unlimited",
+		},
+		&cli.BoolFlag{
+			Name:  "clear",
+			Usage: "remove the quota",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		org := ctx.String("org")
+		sp := ctx.String("sp")
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		user := repo.Users.Get(org)
+		if user == nil {
+			return fmt.Errorf("org %s not found", org)
+		}
+
+		quota := &user.Quota
+		if sp != "" {
+			p := user.Provider(sp)
+			if p == nil {
+				return fmt.Errorf("%s does not belong to org %s", sp, org)
+			}
+			quota = &p.Quota
+		}
+
+		if ctx.Bool("clear") {
+			*quota = nil
+		} else {
+			if *quota == nil {
+				*quota = new(Quota)
+			}
+			if ctx.IsSet("max-day") {
+				(*quota).MaxTiBPerDay = ctx.Float64("max-day")
+			}
+			if ctx.IsSet("max-week") {
+				(*quota).MaxTiBPerWeek = ctx.Float64("max-week")
+			}
+			if ctx.IsSet("max-share") {
+				share := ctx.Float64("max-share")
+				if share < 0 || share > 1 {
+					return fmt.Errorf("--max-share must be between 0 and 1")
+				}
+				(*quota).MaxDataSetShare = share
+			}
+			if ctx.IsSet("max-outstanding") {
+				(*quota).MaxOutstanding = ctx.Int("max-outstanding")
+			}
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("set quota of %s success!\n", org)
+		return nil
+	},
+}
+
 var datasetView = &cli.Command{
 	Name:  "view",
 	Usage: "view all datasets",
@@ -202,7 +372,7 @@ var datasetView = &cli.Command{
 			fmt.Println(data)
 			return nil
 		}
-		table, err := gotable.Create("dataSetName", "duplicate", "spSum", "pieceSum", "pieceSize(TiB)", "carSize(TiB)")
+		table, err := gotable.Create("dataSetName", "status", "clientName", "ldn", "dataOwner", "duplicate", "spSum", "pieceSum", "pieceSize(TiB)", "carSize(TiB)", "description")
 		if err != nil {
 			return err
 		}
@@ -212,13 +382,13 @@ var datasetView = &cli.Command{
 			for _, piece := range dataSet.Pieces {
 				pieceSize += piece.PieceSize
 				carSize += piece.CarSize
-				if len(piece.SpInfos) > spSum {
-					spSum = len(piece.SpInfos)
+				if piece.Replicas() > spSum {
+					spSum = piece.Replicas()
 				}
 			}
 			pieceSum = len(dataSet.Pieces)
 
-			table.AddRow([]string{dataSet.DataSetName, strconv.Itoa(dataSet.Duplicate), strconv.Itoa(spSum), strconv.Itoa(pieceSum), strconv.FormatFloat(float64(pieceSize)/(1<<40), 'f', -1, 64), strconv.FormatFloat(float64(carSize)/(1<<40), 'f', -1, 64)})
+			table.AddRow([]string{dataSet.DataSetName, dataSet.GetStatus(), dataSet.ClientName, dataSet.LDN, dataSet.DataOwner, strconv.Itoa(dataSet.Duplicate), strconv.Itoa(spSum), strconv.Itoa(pieceSum), strconv.FormatFloat(float64(pieceSize)/(1<<40), 'f', -1, 64), strconv.FormatFloat(float64(carSize)/(1<<40), 'f', -1, 64), dataSet.Description})
 
 		}
 
@@ -226,10 +396,80 @@ var datasetView = &cli.Command{
 		return nil
 	},
 }
+var datasetStats = &cli.Command{
+	Name:  "stats",
+	Usage: "show the replica distribution and progress of a dataset",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify dataSet name",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "use json output",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		dataSet := repo.DataSets.GetDataset(ctx.String("name"))
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", ctx.String("name"))
+		}
+		stats := NewDataSetStats(dataSet, repo.Users)
+
+		if ctx.Bool("json") {
+			data, err := json.MarshalIndent(stats, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		tib := func(size int64) string {
+			return strconv.FormatFloat(float64(size)/(1<<40), 'f', -1, 64)
+		}
+		fmt.Printf("dataset: %s, duplicate: %d, pieces: %d, pieceSize: %sTiB, distributed: %sTiB, complete: %.2f%%, remaining: %sTiB\n",
+			stats.DataSetName, stats.Duplicate, stats.Pieces, tib(stats.PieceSize), tib(stats.Distributed), stats.Complete*100, tib(stats.Remaining))
+
+		levels, err := gotable.Create("replicas", "pieces", "pieceSize(TiB)", "histogram")
+		if err != nil {
+			return err
+		}
+		for _, level := range stats.Levels {
+			bar := ""
+			if stats.Pieces > 0 {
+				bar = strings.Repeat("#", (level.Pieces*50+stats.Pieces-1)/stats.Pieces)
+			}
+			levels.AddRow([]string{strconv.Itoa(level.Replicas), strconv.Itoa(level.Pieces), tib(level.PieceSize), bar})
+		}
+		fmt.Println(levels)
+
+		for _, holders := range []struct {
+			name   string
+			shares []*HolderShare
+		}{{"org", stats.Orgs}, {"sp", stats.Sps}} {
+			table, err := gotable.Create(holders.name, "replicas", "pieceSize(TiB)", "share")
+			if err != nil {
+				return err
+			}
+			for _, h := range holders.shares {
+				table.AddRow([]string{h.Name, strconv.Itoa(h.Replicas), tib(h.PieceSize), fmt.Sprintf("%.2f%%", h.Share*100)})
+			}
+			fmt.Println(table)
+		}
+		return nil
+	},
+}
+
 var datasetUpdate = &cli.Command{
 	Name:  "add",
 	Usage: "add a dataset",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:     "name",
 			Usage:    "specify dataSet name",
@@ -237,14 +477,13 @@ var datasetUpdate = &cli.Command{
 			Aliases:  []string{"n"},
 		},
 		&cli.IntFlag{
-			Name:     "duplicate",
-			Usage:    "specify dataSet duplicate",
-			Required: true,
-			Aliases:  []string{"d"},
+			Name:    "duplicate",
+			Usage:   "specify dataSet duplicate, default defaults.duplicate in the repo config",
+			Aliases: []string{"d"},
 		},
 		&cli.StringFlag{
 			Name:     "filepath",
-			Usage:    "specify dataSet filepath. must include pieceCid,pieceSize,carSize",
+			Usage:    "specify dataSet filepath. must include pieceCid,pieceSize,carSize, dataCid is used as the payload cid",
 			Required: true,
 			Aliases:  []string{"f"},
 		},
@@ -253,14 +492,16 @@ var datasetUpdate = &cli.Command{
 			Value: false,
 			Usage: "force update dataset,cover",
 		},
-	},
+	}, dryRunFlags...),
 	Action: func(ctx *cli.Context) error {
 		dataSetName := ctx.String("name")
 		filePath := ctx.String("filepath")
 		duplicate := ctx.Int("duplicate")
+		if duplicate <= 0 {
+			return fmt.Errorf("--duplicate must be greater than 0, specify it or set defaults.duplicate in the repo config")
+		}
 
-		datasets := NewDataSets()
-		dataSet := NewDataSet()
+		dataSet := distribution.NewDataSet()
 
 		f, err := os.Open(filePath)
 		if err != nil {
@@ -285,23 +526,29 @@ var datasetUpdate = &cli.Command{
 		dataSet.DataSetName = dataSetName
 		dataSet.Duplicate = duplicate
 
-		err = datasets.ReadDataSetsFromFile()
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
 		if err != nil {
 			return err
 		}
+		datasets := repo.DataSets
 		if ok := datasets.GetDataset(dataSetName); ok != nil {
 			if !ctx.Bool("force") {
 				return fmt.Errorf("already exist dateset %s, if want to update, please add --force", dataSet.DataSetName)
 			} else {
-				datasets.UpdateDataSet(dataSet)
+				// 只覆盖pieces和副本数，保留数据集的其他配置
+				ok.Pieces = dataSet.Pieces
+				ok.Duplicate = dataSet.Duplicate
 			}
 
 		} else {
 			datasets.AddDataSet(dataSet)
 		}
 
-		err = datasets.WriteDataSetsToFile()
-		if err != nil {
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
 			return err
 		}
 		fmt.Printf("add dataset %s success!\n", dataSet.DataSetName)
@@ -312,7 +559,7 @@ var datasetUpdate = &cli.Command{
 var datasetDelete = &cli.Command{
 	Name:  "delete",
 	Usage: "delete a dataset",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:     "name",
 			Usage:    "specify dataSet name",
@@ -323,21 +570,23 @@ var datasetDelete = &cli.Command{
 			Name:  "really-do-it",
 			Usage: "must be specified for the action to take effect",
 		},
-	},
+	}, dryRunFlags...),
 	Action: func(ctx *cli.Context) error {
 		dataSetName := ctx.String("name")
-		if !ctx.Bool("really-do-it") {
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
 			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
 		}
 
-		datasets := NewDataSets()
-		err := datasets.ReadDataSetsFromFile()
+		repo, err := LoadRepo()
 		if err != nil {
 			return err
 		}
-		if ok := datasets.DeleteDataSet(dataSetName); ok {
-			err = datasets.WriteDataSetsToFile()
-			if err != nil {
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+		if ok := repo.DataSets.DeleteDataSet(dataSetName); ok {
+			if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
 				return err
 			}
 			fmt.Printf("delete dataset %s success!\n", dataSetName)
@@ -349,19 +598,128 @@ var datasetDelete = &cli.Command{
 	},
 }
 
+var datasetSet = &cli.Command{
+	Name:  "set",
+	Usage: "set the properties of a dataset",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify dataSet name",
+			Aliases:  []string{"n"},
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "link-template",
+			Usage: "specify link template, e.g. '{{.BaseURL}}{{.DataSetName}}/{{.DataCid}}/{{.PieceCid}}.car', empty to use prefix + pieceCid + suffix",
+		},
+		&cli.StringFlag{
+			Name:  "strategy",
+			Usage: "specify allocation strategy: " + strings.Join(distribution.StrategyNames(), ", "),
+		},
+		&cli.StringFlag{
+			Name:  "client-name",
+			Usage: "specify the client name",
+		},
+		&cli.StringFlag{
+			Name:  "ldn",
+			Usage: "specify the LDN application issue",
+		},
+		&cli.StringFlag{
+			Name:  "owner",
+			Usage: "specify the data owner",
+		},
+		&cli.StringFlag{
+			Name:  "description",
+			Usage: "specify the description",
+		},
+		&cli.StringFlag{
+			Name:  "status",
+			Usage: "specify the status: open, paused or closed. only open datasets can be allocated",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		dataSetName := ctx.String("name")
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		dataSet := repo.DataSets.GetDataset(dataSetName)
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", dataSetName)
+		}
+		if ctx.IsSet("link-template") {
+			if text := ctx.String("link-template"); text != "" {
+				if _, err := ParseLinkTemplate(text); err != nil {
+					return err
+				}
+			}
+			dataSet.LinkTemplate = ctx.String("link-template")
+		}
+		if ctx.IsSet("strategy") {
+			if _, err := distribution.NewStrategy(ctx.String("strategy"), 0); err != nil {
+				return err
+			}
+			dataSet.Strategy = ctx.String("strategy")
+		}
+		if ctx.IsSet("client-name") {
+			dataSet.ClientName = ctx.String("client-name")
+		}
+		if ctx.IsSet("ldn") {
+			dataSet.LDN = ctx.String("ldn")
+		}
+		if ctx.IsSet("owner") {
+			dataSet.DataOwner = ctx.String("owner")
+		}
+		if ctx.IsSet("description") {
+			dataSet.Description = ctx.String("description")
+		}
+		if ctx.IsSet("status") {
+			if !distribution.ValidDataSetStatus(ctx.String("status")) {
+				return fmt.Errorf("unknown status %s, must be open, paused or closed", ctx.String("status"))
+			}
+			dataSet.Status = ctx.String("status")
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("set dataset %s success!\n", dataSetName)
+		return nil
+	},
+}
+
 var datasetGet = &cli.Command{
 	Name:  "get",
 	Usage: "get the download link for the dataset",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:     "name",
 			Usage:    "specify dataSet name",
 			Required: true,
 		},
 		&cli.StringFlag{
-			Name:     "sp",
-			Usage:    "specify a sp",
-			Required: true,
+			Name:  "sp",
+			Usage: "specify a sp",
+		},
+		&cli.StringFlag{
+			Name:  "org",
+			Usage: "split the size among the sps of the org instead of a single sp, one output file per sp",
+		},
+		&cli.StringFlag{
+			Name:  "split",
+			Usage: "how to split the size with --org: even, weight(sp set --weight) or capacity(sp set --max-daily-ingest)",
+			Value: SplitWeight,
+		},
+		&cli.StringFlag{
+			Name:  "out-dir",
+			Usage: "directory of the output files with --org",
+			Value: ".",
 		},
 		&cli.Float64Flag{
 			Name:     "size",
@@ -377,6 +735,23 @@ var datasetGet = &cli.Command{
 			Usage: "specify dataset repeat",
 			Value: 0,
 		},
+		&cli.StringFlag{
+			Name:  "fit",
+			Usage: "over: the last piece may exceed --size, under: never exceed --size",
+			Value: string(distribution.FitOver),
+		},
+		&cli.StringFlag{
+			Name:  "strategy",
+			Usage: "allocation strategy: " + strings.Join(distribution.StrategyNames(), ", ") + ", default use the dataset's",
+		},
+		&cli.Int64Flag{
+			Name:  "seed",
+			Usage: "seed of the random strategy, default use the current time",
+		},
+		&cli.StringFlag{
+			Name:  "tag",
+			Usage: "only allocate pieces with one of these tags. tag1,tag2",
+		},
 		&cli.StringFlag{
 			Name:    "prefix",
 			Usage:   "specify url prefix",
@@ -388,53 +763,143 @@ var datasetGet = &cli.Command{
 			EnvVars: []string{"DIST_SUFFIX"},
 			Value:   ".car",
 		},
+		&cli.BoolFlag{
+			Name:  "all-mirrors",
+			Usage: "output the urls of all available mirrors, nearest first",
+		},
+		&cli.StringFlag{
+			Name:  "client",
+			Usage: "specify the client address to debit, default use the one with the most DataCap left",
+		},
+		&cli.Float64Flag{
+			Name:  "warn-below",
+			Usage: "warn when the client has less than this share(0-1) of its DataCap left",
+			Value: 0.1,
+		},
+		&cli.BoolFlag{
+			Name:  "check-chain",
+			Usage: "also limit the size by the client's on-chain DataCap, requires --lotus-api",
+		},
+		lotusApiFlag,
+		&cli.StringFlag{
+			Name:  "output",
+			Usage: "output format: " + outputFormats(),
+			Value: "url",
+		},
+		&cli.BoolFlag{
+			Name:  "override-quota",
+			Usage: "ignore the sp and org quotas, recorded in the audit log",
+		},
+		&cli.StringFlag{
+			Name:  "plan",
+			Usage: "write the allocation plan to this file instead of changing the repo, apply it with 'dist alloc apply'",
+		},
 		&cli.BoolFlag{
 			Name:  "really-do-it",
 			Usage: "must be specified for the action to take effect",
 		},
-	},
+	}, append(dealFlags, dryRunFlags...)...),
 	Action: func(ctx *cli.Context) error {
 		dataSetName := ctx.String("name")
 		sp := ctx.String("sp")
+		if (sp == "") == (ctx.String("org") == "") {
+			return fmt.Errorf("please specify one of --sp and --org")
+		}
+		if ctx.IsSet("org") && ctx.IsSet("plan") {
+			return fmt.Errorf("--plan does not support --org, please plan for each sp")
+		}
 		size := int64(ctx.Float64("size") * (1 << 40))
-		if ctx.IsSet("duplicate") {
-			duplicate = ctx.Int("duplicate")
+		if maxSize := repoConfig.Policy.MaxSizePerGet; maxSize > 0 && ctx.Float64("size") > maxSize {
+			return fmt.Errorf("--size %vTiB exceeds the max size per get %vTiB in the repo config", ctx.Float64("size"), maxSize)
+		}
+		if ctx.Bool("override-quota") && !repoConfig.Policy.AllowOverrideQuota {
+			return fmt.Errorf("--override-quota is not allowed by the repo config")
+		}
+		output := ctx.String("output")
+		if _, ok := outputWriters[output]; !ok {
+			return fmt.Errorf("unknown output format %s, must be one of %s", output, outputFormats())
 		}
-		repeat = ctx.Int("repeat")
-		prefix := ctx.String("prefix")
-		suffix := ctx.String("suffix")
 
-		datasets := NewDataSets()
-		err := datasets.ReadDataSetsFromFile()
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
 		if err != nil {
 			return err
 		}
 
-		users := NewUsers()
-		err = users.ReadUsersFromFile()
+		target := repo.DataSets.GetDataset(dataSetName)
+		if target == nil {
+			return fmt.Errorf("dataset %s not found", dataSetName)
+		}
+		params := &AllocParams{
+			DataSetName:   dataSetName,
+			Sp:            sp,
+			Size:          size,
+			Duplicate:     ctx.Int("duplicate"),
+			Repeat:        ctx.Int("repeat"),
+			Fit:           ctx.String("fit"),
+			Strategy:      ctx.String("strategy"),
+			Seed:          ctx.Int64("seed"),
+			Client:        ctx.String("client"),
+			CheckChain:    ctx.Bool("check-chain"),
+			OverrideQuota: ctx.Bool("override-quota"),
+			Tags:          splitList(ctx.String("tag")),
+		}
+		if params.Strategy == "" {
+			params.Strategy = target.Strategy
+		}
+		if params.Strategy == distribution.StrategyRandom && !ctx.IsSet("seed") {
+			params.Seed = time.Now().UnixNano()
+			fmt.Fprintf(os.Stderr, "random seed: %d\n", params.Seed)
+		}
+		if ctx.IsSet("org") {
+			return datasetGetOrg(ctx, repo, before, target, params, os.Stderr)
+		}
+
+		alloc, result, err := allocate(ctx, repo, params, os.Stderr)
 		if err != nil {
 			return err
 		}
-		sps := users.GetSps(sp)
 
-		if len(sps) == 0 {
-			return fmt.Errorf("%s does not belong to any organization, please add user sp first", sp)
+		if ctx.IsSet("plan") {
+			plan, err := NewPlan(before, params, alloc)
+			if err != nil {
+				return err
+			}
+			if err := WritePlan(ctx.String("plan"), plan); err != nil {
+				return err
+			}
+			fmt.Printf("plan with %d pieces (%vTiB) written to %s, apply it with: dist alloc apply %s\n", len(plan.Pieces), float64(plan.PieceSize)/(1<<40), ctx.String("plan"), ctx.String("plan"))
+			return nil
 		}
 
-		dataSet, pieceSize, carSize := datasets.GetDataset(dataSetName).GetSize(sp, size, sps)
+		if ctx.Bool("dry-run") {
+			_, err = commitRepo(ctx, before, repo)
+			return err
+		}
 
-		for _, piece := range dataSet.Pieces {
-			fmt.Printf("%s%s%s\n", prefix, piece.PieceCid, suffix)
+		out, err := allocOutput(ctx, repo, target, alloc, result.Pieces)
+		if err != nil {
+			return err
+		}
+		out.Summary.MissingPieceSize = size - result.PieceSize
+		if err := WriteOutput(os.Stdout, output, out); err != nil {
+			return err
+		}
+		if err := WriteSummary(os.Stdout, os.Stderr, output, out.Summary); err != nil {
+			return err
 		}
-		fmt.Printf("total pieceSize:%v, total carSize: %v, missing pieceSize:%v\n", float64(pieceSize)/(1<<40), float64(carSize)/(1<<40), float64(size-pieceSize)/(1<<40))
 
 		if !ctx.Bool("really-do-it") {
 			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
-		} else {
-			err = datasets.WriteDataSetsToFile()
-			if err != nil {
-				return err
-			}
+		}
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		if alloc.ID > 0 {
+			fmt.Fprintf(os.Stderr, "allocation %d recorded\n", alloc.ID)
 		}
 		return nil
 	},
@@ -443,7 +908,7 @@ var datasetGet = &cli.Command{
 var pieceUpdate = &cli.Command{
 	Name:  "add",
 	Usage: "add piece",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:     "name",
 			Usage:    "specify dataSet name",
@@ -464,6 +929,10 @@ var pieceUpdate = &cli.Command{
 			Usage:    "specify carSize",
 			Required: true,
 		},
+		&cli.StringFlag{
+			Name:  "dataCid",
+			Usage: "specify payload cid",
+		},
 		&cli.StringFlag{
 			Name:     "sps",
 			Usage:    "specify sps. f01001,f01002",
@@ -474,16 +943,19 @@ var pieceUpdate = &cli.Command{
 			Value: false,
 			Usage: "force update piece,cover",
 		},
-	},
+	}, dryRunFlags...),
 	Action: func(ctx *cli.Context) error {
 		dataSetName := ctx.String("name")
 		pieceCid := ctx.String("pieceCid")
 		pieceSize := ctx.Int64("pieceSize")
 		carSize := ctx.Int64("carSize")
-		sps := strings.Split(strings.TrimSpace(ctx.String("sps")), ",")
+		sps := splitList(ctx.String("sps"))
 
-		dataSets := NewDataSets()
-		err := dataSets.ReadDataSetsFromFile()
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
 		if err != nil {
 			return err
 		}
@@ -492,6 +964,7 @@ var pieceUpdate = &cli.Command{
 		piece.PieceCid = pieceCid
 		piece.PieceSize = pieceSize
 		piece.CarSize = carSize
+		piece.DataCid = ctx.String("dataCid")
 		for _, sp := range sps {
 			spInfo := new(SpInfo)
 			spInfo.Sp = sp
@@ -499,7 +972,10 @@ var pieceUpdate = &cli.Command{
 			piece.SpInfos = append(piece.SpInfos, spInfo)
 		}
 
-		dataSet := dataSets.GetDataset(dataSetName)
+		dataSet := repo.DataSets.GetDataset(dataSetName)
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", dataSetName)
+		}
 
 		if ok := dataSet.Get(piece.PieceCid); ok != nil {
 			if !ctx.Bool("force") {
@@ -511,8 +987,7 @@ var pieceUpdate = &cli.Command{
 			dataSet.Add(piece)
 		}
 
-		err = dataSets.WriteDataSetsToFile()
-		if err != nil {
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
 			return err
 		}
 		fmt.Printf("add piece %s success!\n", piece.PieceCid)
@@ -524,7 +999,7 @@ var pieceUpdate = &cli.Command{
 var pieceDelete = &cli.Command{
 	Name:  "delete",
 	Usage: "delete piece",
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:     "name",
 			Usage:    "specify dataSet name",
@@ -539,25 +1014,30 @@ var pieceDelete = &cli.Command{
 			Name:  "really-do-it",
 			Usage: "must be specified for the action to take effect",
 		},
-	},
+	}, dryRunFlags...),
 	Action: func(ctx *cli.Context) error {
 		dataSetName := ctx.String("name")
 		pieceCid := ctx.String("pieceCid")
-		if !ctx.Bool("really-do-it") {
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
 			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
 		}
 
-		dataSets := NewDataSets()
-		err := dataSets.ReadDataSetsFromFile()
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
 		if err != nil {
 			return err
 		}
 
-		dataSet := dataSets.GetDataset(dataSetName)
+		dataSet := repo.DataSets.GetDataset(dataSetName)
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", dataSetName)
+		}
 
 		if ok := dataSet.Delete(pieceCid); ok {
-			err = dataSets.WriteDataSetsToFile()
-			if err != nil {
+			if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
 				return err
 			}
 			fmt.Printf("delete piece %s success!\n", dataSetName)
@@ -577,6 +1057,10 @@ var pieceView = &cli.Command{
 			Usage:    "specify dataSet name",
 			Required: true,
 		},
+		&cli.StringFlag{
+			Name:  "tag",
+			Usage: "only show pieces with one of these tags. tag1,tag2",
+		},
 		&cli.BoolFlag{
 			Name:  "json",
 			Usage: "use json output",
@@ -591,6 +1075,19 @@ var pieceView = &cli.Command{
 		}
 
 		dataSet := dataSets.GetDataset(dataSetName)
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", dataSetName)
+		}
+		if tags := splitList(ctx.String("tag")); len(tags) > 0 {
+			filtered := *dataSet
+			filtered.Pieces = nil
+			for _, piece := range dataSet.Pieces {
+				if piece.HasAnyTag(tags) {
+					filtered.Pieces = append(filtered.Pieces, piece)
+				}
+			}
+			dataSet = &filtered
+		}
 
 		if ctx.Bool("json") {
 			data, err := json.MarshalIndent(dataSet, "", "    ")
@@ -601,20 +1098,24 @@ var pieceView = &cli.Command{
 			return nil
 		}
 
-		table, err := gotable.Create("pieceCid", "pieceSize(GiB)", "carSize(GiB)", "sps")
+		table, err := gotable.Create("pieceCid", "pieceSize(GiB)", "carSize(GiB)", "priority", "tags", "sps")
 		if err != nil {
 			return err
 		}
 		for _, piece := range dataSet.Pieces {
 			var sps []string
 			for _, sp := range piece.SpInfos {
-				sps = append(sps, sp.Sp)
+				if sp.Lost {
+					sps = append(sps, sp.Sp+"(lost)")
+				} else {
+					sps = append(sps, sp.Sp)
+				}
 			}
 			sp, err := json.Marshal(sps)
 			if err != nil {
 				return err
 			}
-			table.AddRow([]string{piece.PieceCid, strconv.FormatFloat(float64(piece.PieceSize)/(1<<30), 'f', -1, 64), strconv.FormatFloat(float64(piece.CarSize)/(1<<30), 'f', -1, 64), string(sp)})
+			table.AddRow([]string{piece.PieceCid, strconv.FormatFloat(float64(piece.PieceSize)/(1<<30), 'f', -1, 64), strconv.FormatFloat(float64(piece.CarSize)/(1<<30), 'f', -1, 64), strconv.Itoa(piece.Priority), strings.Join(piece.Tags, ","), string(sp)})
 
 		}
 
@@ -622,3 +1123,117 @@ var pieceView = &cli.Command{
 		return nil
 	},
 }
+
+var pieceTag = &cli.Command{
+	Name:  "tag",
+	Usage: "set the priority and tags of pieces",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify dataSet name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "pieceCid",
+			Usage: "specify pieceCids. pieceCid1,pieceCid2",
+		},
+		&cli.StringFlag{
+			Name:  "tag",
+			Usage: "add these tags. tag1,tag2",
+		},
+		&cli.StringFlag{
+			Name:  "untag",
+			Usage: "remove these tags. tag1,tag2",
+		},
+		&cli.IntFlag{
+			Name:  "priority",
+			Usage: "set the priority, the higher the first",
+		},
+		&cli.StringFlag{
+			Name:  "file",
+			Usage: "bulk set from a file, one json per line: {\"pieceCid\":\"...\",\"priority\":1,\"tags\":[\"2024-Q3\"]}, the tags replace the old ones",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		dataSetName := ctx.String("name")
+		if ctx.IsSet("pieceCid") == ctx.IsSet("file") {
+			return fmt.Errorf("please specify one of --pieceCid and --file")
+		}
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		dataSet := repo.DataSets.GetDataset(dataSetName)
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", dataSetName)
+		}
+
+		var count int
+		if ctx.IsSet("file") {
+			f, err := os.Open(ctx.String("file"))
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				if len(strings.TrimSpace(scanner.Text())) == 0 {
+					continue
+				}
+				update := new(Piece)
+				if err := json.Unmarshal(scanner.Bytes(), update); err != nil {
+					return err
+				}
+				piece := dataSet.Get(update.PieceCid)
+				if piece == nil {
+					return fmt.Errorf("piece %s not found in dataset %s", update.PieceCid, dataSetName)
+				}
+				piece.Priority = update.Priority
+				piece.Tags = appendUnique(nil, update.Tags...)
+				count++
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+		} else {
+			for _, pieceCid := range splitList(ctx.String("pieceCid")) {
+				piece := dataSet.Get(pieceCid)
+				if piece == nil {
+					return fmt.Errorf("piece %s not found in dataset %s", pieceCid, dataSetName)
+				}
+				if ctx.IsSet("priority") {
+					piece.Priority = ctx.Int("priority")
+				}
+				piece.Tags = appendUnique(piece.Tags, splitList(ctx.String("tag"))...)
+				for _, tag := range splitList(ctx.String("untag")) {
+					piece.Tags = removeString(piece.Tags, tag)
+				}
+				count++
+			}
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("tag %d pieces success!\n", count)
+		return nil
+	},
+}
+
+// splitList 按逗号分隔，去掉空白和空项
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
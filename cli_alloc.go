@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liushuochen/gotable"
+	"github.com/urfave/cli/v2"
+)
+
+var allocManager = &cli.Command{
+	Name:  "alloc",
+	Usage: "allocation manager",
+	Subcommands: []*cli.Command{
+		allocList,
+		allocConfirm,
+		allocExport,
+		allocApply,
+	},
+}
+
+var dealFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "verified",
+		Usage: "make verified deals",
+		Value: true,
+	},
+	&cli.Int64Flag{
+		Name:  "start-epoch",
+		Usage: "deal start epoch, default use the current epoch plus --start-delay",
+	},
+	&cli.IntFlag{
+		Name:  "start-delay",
+		Usage: "days from now to the deal start epoch",
+		Value: 7,
+	},
+	&cli.Int64Flag{
+		Name:  "duration",
+		Usage: "deal duration in epochs",
+		Value: 1468800,
+	},
+	&cli.StringFlag{
+		Name:  "wallet",
+		Usage: "client wallet making the deals, default use the allocation's client address",
+	},
+}
+
+// dealParams 从命令行参数读取 boost 发单参数
+func dealParams(ctx *cli.Context) *DealParams {
+	deal := &DealParams{
+		Verified:   ctx.Bool("verified"),
+		StartEpoch: ctx.Int64("start-epoch"),
+		Duration:   ctx.Int64("duration"),
+		Wallet:     ctx.String("wallet"),
+	}
+	if !ctx.IsSet("start-epoch") {
+		deal.StartEpoch = currentEpoch(time.Now()) + int64(ctx.Int("start-delay"))*epochsPerDay
+	}
+	return deal
+}
+
+var allocList = &cli.Command{
+	Name:  "list",
+	Usage: "list allocations",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "specify dataSet name",
+		},
+		&cli.StringFlag{
+			Name:  "sp",
+			Usage: "specify a sp",
+		},
+		&cli.StringFlag{
+			Name:  "org",
+			Usage: "specify org",
+		},
+		&cli.BoolFlag{
+			Name:  "unconfirmed",
+			Usage: "only show unconfirmed allocations",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "use json output",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		allocs := NewAllocations()
+		if err := allocs.ReadAllocationsFromFile(); err != nil {
+			return err
+		}
+
+		out := allocs.Filter(func(alloc *Allocation) bool {
+			if ctx.IsSet("name") && alloc.DataSetName != ctx.String("name") {
+				return false
+			}
+			if ctx.IsSet("sp") && alloc.Sp != ctx.String("sp") {
+				return false
+			}
+			if ctx.IsSet("org") && alloc.Org != ctx.String("org") {
+				return false
+			}
+			return !ctx.Bool("unconfirmed") || !alloc.Confirmed
+		})
+
+		if ctx.Bool("json") {
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		table, err := gotable.Create("id", "time", "dataSetName", "org", "sp", "pieceSum", "pieceSize(TiB)", "confirmed", "override")
+		if err != nil {
+			return err
+		}
+		for _, alloc := range out {
+			table.AddRow([]string{strconv.FormatInt(alloc.ID, 10), alloc.Time.Format(time.RFC3339), alloc.DataSetName, alloc.Org, alloc.Sp, strconv.Itoa(len(alloc.Pieces)), strconv.FormatFloat(float64(alloc.PieceSize)/(1<<40), 'f', -1, 64), strconv.FormatBool(alloc.Confirmed), strconv.FormatBool(alloc.Override)})
+		}
+		fmt.Println(table)
+		return nil
+	},
+}
+
+var allocExport = &cli.Command{
+	Name:  "export",
+	Usage: "export the pieces of an allocation",
+	Flags: append([]cli.Flag{
+		&cli.Int64Flag{
+			Name:     "id",
+			Usage:    "specify allocation id",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: " + outputFormats(),
+			Value: "boost",
+		},
+		&cli.StringFlag{
+			Name:    "prefix",
+			Usage:   "specify url prefix",
+			EnvVars: []string{"DIST_PREFIX"},
+		},
+		&cli.StringFlag{
+			Name:    "suffix",
+			Usage:   "specify url suffix",
+			EnvVars: []string{"DIST_SUFFIX"},
+			Value:   ".car",
+		},
+		&cli.BoolFlag{
+			Name:  "all-mirrors",
+			Usage: "output the urls of all available mirrors, nearest first",
+		},
+	}, dealFlags...),
+	Action: func(ctx *cli.Context) error {
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+
+		alloc := repo.Allocations.Get(ctx.Int64("id"))
+		if alloc == nil {
+			return fmt.Errorf("allocation %d not found", ctx.Int64("id"))
+		}
+		dataSet := repo.DataSets.GetDataset(alloc.DataSetName)
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", alloc.DataSetName)
+		}
+		var pieces []*Piece
+		for _, pieceCid := range alloc.Pieces {
+			piece := dataSet.Get(pieceCid)
+			if piece == nil {
+				return fmt.Errorf("piece %s not found in dataset %s", pieceCid, alloc.DataSetName)
+			}
+			pieces = append(pieces, piece)
+		}
+		out, err := allocOutput(ctx, repo, dataSet, alloc, pieces)
+		if err != nil {
+			return err
+		}
+		if err := WriteOutput(os.Stdout, ctx.String("format"), out); err != nil {
+			return err
+		}
+		return WriteSummary(os.Stdout, os.Stderr, ctx.String("format"), out.Summary)
+	},
+}
+
+var allocConfirm = &cli.Command{
+	Name:  "confirm",
+	Usage: "confirm that the sp has received the allocations",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "id",
+			Usage:    "specify allocation ids. 1,2,3",
+			Required: true,
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		for _, s := range strings.Split(ctx.String("id"), ",") {
+			id, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid allocation id %s", s)
+			}
+			alloc := repo.Allocations.Get(id)
+			if alloc == nil {
+				return fmt.Errorf("allocation %d not found", id)
+			}
+			alloc.Confirmed = true
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("confirm allocation %s success!\n", ctx.String("id"))
+		return nil
+	},
+}
+
+var allocApply = &cli.Command{
+	Name:      "apply",
+	Usage:     "apply an allocation plan written by 'dist dataset get --plan'",
+	ArgsUsage: "<plan.json>",
+	Flags: append([]cli.Flag{
+		&cli.Float64Flag{
+			Name:  "warn-below",
+			Usage: "warn when the client has less than this share(0-1) of its DataCap left",
+			Value: 0.1,
+		},
+		lotusApiFlag,
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			return fmt.Errorf("usage: %s <plan.json>", ctx.Command.HelpName)
+		}
+		plan, err := ReadPlan(ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		if plan.Params.OverrideQuota && !repoConfig.Policy.AllowOverrideQuota {
+			return fmt.Errorf("the plan overrides the quota, which is not allowed by the repo config")
+		}
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+		stateHash, err := repo.StateHash()
+		if err != nil {
+			return err
+		}
+		if stateHash != plan.StateHash {
+			return fmt.Errorf("the repo has changed since the plan was made at %s, please make a new plan", plan.Time.Format(time.RFC3339))
+		}
+
+		alloc, _, err := allocate(ctx, repo, plan.Params, os.Stderr)
+		if err != nil {
+			return err
+		}
+		if strings.Join(alloc.Pieces, ",") != strings.Join(plan.Pieces, ",") {
+			return fmt.Errorf("the allocation does not match the plan, got %d pieces, want %d", len(alloc.Pieces), len(plan.Pieces))
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		if alloc.ID > 0 {
+			fmt.Printf("allocation %d recorded, export it with: dist alloc export --id %d\n", alloc.ID, alloc.ID)
+		}
+		return nil
+	},
+}
+
+// allocOutput 按 --prefix、--suffix、--all-mirrors 和交易参数生成一次分配的输出
+func allocOutput(ctx *cli.Context, repo *Repo, dataSet *DataSet, alloc *Allocation, pieces []*Piece) (*Output, error) {
+	var region string
+	if user := repo.Users.GetBySp(alloc.Sp); user != nil {
+		region = user.Region(alloc.Sp)
+	}
+	out := &Output{
+		Deal:    dealParams(ctx),
+		Summary: &OutputSummary{PieceSize: alloc.PieceSize, CarSize: alloc.CarSize, AllocationID: alloc.ID},
+	}
+	link := LinkData{BaseURL: ctx.String("prefix"), Suffix: ctx.String("suffix"), Sp: alloc.Sp, AllocationID: alloc.ID}
+	for _, piece := range pieces {
+		urls, err := repo.Mirrors.PieceURLs(dataSet, piece, link, region, ctx.Bool("all-mirrors"))
+		if err != nil {
+			return nil, err
+		}
+		file, err := repo.Mirrors.PiecePath(dataSet, piece, link, region)
+		if err != nil {
+			return nil, err
+		}
+		out.Items = append(out.Items, &OutputItem{
+			DataSetName:  dataSet.DataSetName,
+			Sp:           alloc.Sp,
+			Client:       alloc.Client,
+			AllocationID: alloc.ID,
+			Piece:        piece,
+			URLs:         urls,
+			Path:         file,
+		})
+	}
+	out.Summary.Pieces = len(out.Items)
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/liushuochen/gotable"
+	"github.com/urfave/cli/v2"
+)
+
+var auditManager = &cli.Command{
+	Name:  "audit",
+	Usage: "audit log of all mutating operations",
+	Subcommands: []*cli.Command{
+		auditList,
+		auditVerify,
+	},
+}
+
+var auditList = &cli.Command{
+	Name:  "list",
+	Usage: "list audit log entries",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "sp",
+			Usage: "only show entries touching the sp",
+		},
+		&cli.StringFlag{
+			Name:  "org",
+			Usage: "only show entries touching the org",
+		},
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "only show entries touching the dataSet",
+		},
+		&cli.StringFlag{
+			Name:  "operator",
+			Usage: "only show entries by the operator",
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "only show entries after the time. 7d, 2w, 36h or 2006-01-02",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "use json output",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		entries, err := ReadAuditLog()
+		if err != nil {
+			return err
+		}
+
+		var since time.Time
+		if ctx.IsSet("since") {
+			since, err = parseSince(ctx.String("since"))
+			if err != nil {
+				return err
+			}
+		}
+
+		var out []*AuditEntry
+		for _, entry := range entries {
+			if entry.Time.Before(since) {
+				continue
+			}
+			if ctx.IsSet("sp") && !entry.HasSp(ctx.String("sp")) {
+				continue
+			}
+			if ctx.IsSet("org") && !containsString(entry.Orgs, ctx.String("org")) {
+				continue
+			}
+			if ctx.IsSet("name") && !containsString(entry.DataSets, ctx.String("name")) {
+				continue
+			}
+			if ctx.IsSet("operator") && entry.Operator != ctx.String("operator") {
+				continue
+			}
+			out = append(out, entry)
+		}
+
+		if ctx.Bool("json") {
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		table, err := gotable.Create("seq", "time", "operator", "command", "args", "changes", "replicas(before/after)")
+		if err != nil {
+			return err
+		}
+		for _, entry := range out {
+			table.AddRow([]string{strconv.FormatInt(entry.Seq, 10), entry.Time.Format(time.RFC3339), entry.Operator, entry.Command, strings.Join(entry.Args, " "), entry.Changes, fmt.Sprintf("%d/%d", entry.Before.Replicas, entry.After.Replicas)})
+		}
+		fmt.Println(table)
+		return nil
+	},
+}
+
+var auditVerify = &cli.Command{
+	Name:  "verify",
+	Usage: "verify the hash chain of the audit log and that no trailing entries were removed (compared with audit.head)",
+	Action: func(ctx *cli.Context) error {
+		entries, err := ReadAuditLog()
+		if err != nil {
+			return err
+		}
+		if err := VerifyAuditLog(entries); err != nil {
+			return fmt.Errorf("audit log verification failed: %w", err)
+		}
+		fmt.Printf("audit log ok, %d entries\n", len(entries))
+		if len(entries) > 0 {
+			last := entries[len(entries)-1]
+			fmt.Printf("head: seq %d, hash %s\n", last.Seq, last.Hash)
+		}
+		return nil
+	},
+}
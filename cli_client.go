@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/liushuochen/gotable"
+	"github.com/urfave/cli/v2"
+)
+
+var lotusApiFlag = &cli.StringFlag{
+	Name:    "lotus-api",
+	Usage:   "lotus full node api. token:/ip4/127.0.0.1/tcp/1234/http",
+	EnvVars: []string{"FULLNODE_API_INFO"},
+}
+
+var clientManager = &cli.Command{
+	Name:  "client",
+	Usage: "verified client and DataCap budget manager",
+	Subcommands: []*cli.Command{
+		clientView,
+		clientUpdate,
+		clientDelete,
+		clientCheck,
+	},
+}
+
+var clientView = &cli.Command{
+	Name:  "view",
+	Usage: "view the clients linked to datasets",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "specify dataSet name",
+		},
+		&cli.Float64Flag{
+			Name:  "warn-below",
+			Usage: "warn when the client has less than this share(0-1) of its DataCap left",
+			Value: 0.1,
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "use json output",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		dataSets := NewDataSets()
+		if err := dataSets.ReadDataSetsFromFile(); err != nil {
+			return err
+		}
+
+		type clientRow struct {
+			DataSetName string `json:"dataSetName"`
+			*Client
+			Remaining int64  `json:"remaining"`
+			Warning   string `json:"warning,omitempty"`
+		}
+		var rows []*clientRow
+		for _, dataSet := range dataSets.List {
+			if ctx.IsSet("name") && dataSet.DataSetName != ctx.String("name") {
+				continue
+			}
+			for _, client := range dataSet.Clients {
+				rows = append(rows, &clientRow{DataSetName: dataSet.DataSetName, Client: client, Remaining: client.Remaining(), Warning: DataCapWarning(client, ctx.Float64("warn-below"))})
+			}
+		}
+
+		if ctx.Bool("json") {
+			data, err := json.MarshalIndent(rows, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		table, err := gotable.Create("dataSetName", "address", "dataCap(TiB)", "used(TiB)", "remaining(TiB)", "warning")
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			table.AddRow([]string{row.DataSetName, row.Address, strconv.FormatFloat(float64(row.DataCap)/(1<<40), 'f', -1, 64), strconv.FormatFloat(float64(row.Used)/(1<<40), 'f', -1, 64), strconv.FormatFloat(float64(row.Remaining)/(1<<40), 'f', -1, 64), row.Warning})
+		}
+		fmt.Println(table)
+		return nil
+	},
+}
+
+var clientUpdate = &cli.Command{
+	Name:  "add",
+	Usage: "link a client address and its DataCap budget to a dataset",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify dataSet name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "address",
+			Usage:    "specify client address",
+			Required: true,
+		},
+		&cli.Float64Flag{
+			Name:     "datacap",
+			Usage:    "specify DataCap budget(TiB)",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Value: false,
+			Usage: "force update the budget, the used DataCap is kept",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		dataSetName := ctx.String("name")
+		address := ctx.String("address")
+		dataCap := int64(ctx.Float64("datacap") * (1 << 40))
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		dataSet := repo.DataSets.GetDataset(dataSetName)
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", dataSetName)
+		}
+		if client := dataSet.GetClient(address); client != nil {
+			if !ctx.Bool("force") {
+				return fmt.Errorf("already exist client %s, if want to update, please add --force", address)
+			}
+			client.DataCap = dataCap
+		} else {
+			dataSet.Clients = append(dataSet.Clients, &Client{Address: address, DataCap: dataCap})
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("add client %s success!\n", address)
+		return nil
+	},
+}
+
+var clientDelete = &cli.Command{
+	Name:  "delete",
+	Usage: "unlink a client address from a dataset",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify dataSet name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "address",
+			Usage:    "specify client address",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "must be specified for the action to take effect",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		dataSetName := ctx.String("name")
+		address := ctx.String("address")
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
+			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
+		}
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		dataSet := repo.DataSets.GetDataset(dataSetName)
+		if dataSet == nil {
+			return fmt.Errorf("dataset %s not found", dataSetName)
+		}
+		if ok := dataSet.DeleteClient(address); ok {
+			if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+				return err
+			}
+			fmt.Printf("delete client %s success!\n", address)
+		} else {
+			fmt.Printf("delete client %s failed!!!\n", address)
+		}
+		return nil
+	},
+}
+
+var clientCheck = &cli.Command{
+	Name:  "check",
+	Usage: "compare the DataCap budgets with the on-chain allowance",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "specify dataSet name",
+		},
+		lotusApiFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		dataSets := NewDataSets()
+		if err := dataSets.ReadDataSetsFromFile(); err != nil {
+			return err
+		}
+
+		table, err := gotable.Create("dataSetName", "address", "remaining(TiB)", "onChain(TiB)", "status")
+		if err != nil {
+			return err
+		}
+		for _, dataSet := range dataSets.List {
+			if ctx.IsSet("name") && dataSet.DataSetName != ctx.String("name") {
+				continue
+			}
+			for _, client := range dataSet.Clients {
+				onChain, err := checkOnChainDataCap(ctx, client.Address)
+				if err != nil {
+					return err
+				}
+				status := "ok"
+				if onChain < client.Remaining() {
+					status = "insufficient"
+				}
+				table.AddRow([]string{dataSet.DataSetName, client.Address, strconv.FormatFloat(float64(client.Remaining())/(1<<40), 'f', -1, 64), strconv.FormatFloat(float64(onChain)/(1<<40), 'f', -1, 64), status})
+			}
+		}
+		fmt.Println(table)
+		return nil
+	},
+}
+
+// checkOnChainDataCap 通过 --lotus-api 查询client链上剩余的 DataCap(bytes)
+func checkOnChainDataCap(ctx *cli.Context, address string) (int64, error) {
+	api, err := NewLotusClient(ctx.String("lotus-api"))
+	if err != nil {
+		return 0, err
+	}
+	dataCap, err := api.VerifiedClientStatus(context.Background(), address)
+	if err != nil {
+		return 0, err
+	}
+	if !dataCap.IsInt64() {
+		return math.MaxInt64, nil
+	}
+	return dataCap.Int64(), nil
+}
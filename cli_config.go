@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/urfave/cli/v2"
+)
+
+var configManager = &cli.Command{
+	Name:  "config",
+	Usage: "repo config manager",
+	Subcommands: []*cli.Command{
+		configShow,
+		configGet,
+		configSet,
+	},
+}
+
+var configShow = &cli.Command{
+	Name:  "show",
+	Usage: "show the repo config",
+	Action: func(ctx *cli.Context) error {
+		fmt.Printf("# %s\n", configFile)
+		return toml.NewEncoder(os.Stdout).Encode(repoConfig)
+	},
+}
+
+var configGet = &cli.Command{
+	Name:      "get",
+	Usage:     "get a config value",
+	ArgsUsage: "<section.key>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			return fmt.Errorf("usage: %s <section.key>", ctx.Command.HelpName)
+		}
+		value, err := repoConfig.Get(ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	},
+}
+
+var configSet = &cli.Command{
+	Name:      "set",
+	Usage:     "set a config value, lists are separated by comma",
+	ArgsUsage: "<section.key> <value>",
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 2 {
+			return fmt.Errorf("usage: %s <section.key> <value>", ctx.Command.HelpName)
+		}
+		key, value := ctx.Args().Get(0), ctx.Args().Get(1)
+		if err := repoConfig.Set(key, value); err != nil {
+			return err
+		}
+		if err := repoConfig.Write(configFile); err != nil {
+			return err
+		}
+		fmt.Printf("set %s success!\n", key)
+		return nil
+	},
+}
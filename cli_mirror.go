@@ -0,0 +1,353 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/liushuochen/gotable"
+	"github.com/urfave/cli/v2"
+)
+
+var mirrorManager = &cli.Command{
+	Name:  "mirror",
+	Usage: "download mirror manager",
+	Subcommands: []*cli.Command{
+		mirrorView,
+		mirrorUpdate,
+		mirrorDelete,
+		mirrorDisable,
+		mirrorEnable,
+		mirrorLink,
+		mirrorUnlink,
+	},
+}
+
+var mirrorView = &cli.Command{
+	Name:  "view",
+	Usage: "view all mirrors",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "use json output",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+
+		if ctx.Bool("json") {
+			data, err := json.MarshalIndent(repo.Mirrors.List, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		table, err := gotable.Create("name", "baseUrl", "region", "capacity(Gbps)", "priority", "status", "template", "dataSets")
+		if err != nil {
+			return err
+		}
+		for _, mirror := range repo.Mirrors.List {
+			status := "up"
+			if mirror.Down {
+				status = "down"
+				if mirror.DownReason != "" {
+					status += ": " + mirror.DownReason
+				}
+			}
+			var dataSets []string
+			for _, dataSet := range repo.DataSets.List {
+				if containsString(dataSet.Mirrors, mirror.Name) {
+					dataSets = append(dataSets, dataSet.DataSetName)
+				}
+			}
+			table.AddRow([]string{mirror.Name, mirror.BaseURL, mirror.Region, strconv.FormatFloat(mirror.Capacity, 'f', -1, 64), strconv.Itoa(mirror.Priority), status, mirror.Template, strings.Join(dataSets, ",")})
+		}
+		fmt.Println(table)
+		return nil
+	},
+}
+
+var mirrorUpdate = &cli.Command{
+	Name:  "add",
+	Usage: "add a mirror",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify mirror name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "url",
+			Usage:    "specify the url prefix of the car files, e.g. https://mirror.example.com/dataset/",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "region",
+			Usage: "specify mirror region, e.g. asia-east",
+		},
+		&cli.Float64Flag{
+			Name:  "capacity",
+			Usage: "specify mirror bandwidth(Gbps)",
+		},
+		&cli.IntFlag{
+			Name:  "priority",
+			Usage: "specify mirror priority, the smaller the first",
+		},
+		&cli.StringFlag{
+			Name:  "template",
+			Usage: "specify link template, e.g. '{{.BaseURL}}{{.DataCid}}/{{.PieceCid}}.car', default use the dataset's",
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Value: false,
+			Usage: "force update the mirror",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		name := ctx.String("name")
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		if ctx.String("template") != "" {
+			if _, err := ParseLinkTemplate(ctx.String("template")); err != nil {
+				return err
+			}
+		}
+
+		mirror := &Mirror{
+			Name:     name,
+			BaseURL:  ctx.String("url"),
+			Region:   ctx.String("region"),
+			Capacity: ctx.Float64("capacity"),
+			Priority: ctx.Int("priority"),
+			Template: ctx.String("template"),
+		}
+		if old := repo.Mirrors.Get(name); old != nil {
+			if !ctx.Bool("force") {
+				return fmt.Errorf("already exist mirror %s, if want to update, please add --force", name)
+			}
+			mirror.Down, mirror.DownReason = old.Down, old.DownReason
+			*old = *mirror
+		} else {
+			repo.Mirrors.Add(mirror)
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("add mirror %s success!\n", name)
+		return nil
+	},
+}
+
+var mirrorDelete = &cli.Command{
+	Name:  "delete",
+	Usage: "delete a mirror and unlink it from all datasets and pieces",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify mirror name",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "must be specified for the action to take effect",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		name := ctx.String("name")
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
+			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
+		}
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		if ok := repo.Mirrors.Delete(name); !ok {
+			fmt.Printf("delete mirror %s failed!!!\n", name)
+			return nil
+		}
+		for _, dataSet := range repo.DataSets.List {
+			dataSet.Mirrors = removeString(dataSet.Mirrors, name)
+			for _, piece := range dataSet.Pieces {
+				piece.Mirrors = removeString(piece.Mirrors, name)
+			}
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("delete mirror %s success!\n", name)
+		return nil
+	},
+}
+
+var mirrorDisable = &cli.Command{
+	Name:  "disable",
+	Usage: "mark a mirror as down, it is skipped when generating urls",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify mirror name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "why the mirror is down",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		return setMirrorDown(ctx, true, ctx.String("reason"))
+	},
+}
+
+var mirrorEnable = &cli.Command{
+	Name:  "enable",
+	Usage: "mark a mirror as up",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify mirror name",
+			Required: true,
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		return setMirrorDown(ctx, false, "")
+	},
+}
+
+func setMirrorDown(ctx *cli.Context, down bool, reason string) error {
+	name := ctx.String("name")
+
+	repo, err := LoadRepo()
+	if err != nil {
+		return err
+	}
+	before, err := repo.Clone()
+	if err != nil {
+		return err
+	}
+
+	mirror := repo.Mirrors.Get(name)
+	if mirror == nil {
+		return fmt.Errorf("mirror %s not found", name)
+	}
+	mirror.Down, mirror.DownReason = down, reason
+
+	if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+		return err
+	}
+	fmt.Printf("%s mirror %s success!\n", ctx.Command.Name, name)
+	return nil
+}
+
+var mirrorLinkFlags = append([]cli.Flag{
+	&cli.StringFlag{
+		Name:     "name",
+		Usage:    "specify mirror name",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:     "dataset",
+		Usage:    "specify dataSet name",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:  "pieceCid",
+		Usage: "only (un)link these pieces, default the whole dataset. pieceCid1,pieceCid2",
+	},
+}, dryRunFlags...)
+
+var mirrorLink = &cli.Command{
+	Name:  "link",
+	Usage: "serve the pieces of a dataset from a mirror",
+	Flags: mirrorLinkFlags,
+	Action: func(ctx *cli.Context) error {
+		return linkMirror(ctx, true)
+	},
+}
+
+var mirrorUnlink = &cli.Command{
+	Name:  "unlink",
+	Usage: "stop serving the pieces of a dataset from a mirror",
+	Flags: mirrorLinkFlags,
+	Action: func(ctx *cli.Context) error {
+		return linkMirror(ctx, false)
+	},
+}
+
+func linkMirror(ctx *cli.Context, link bool) error {
+	name := ctx.String("name")
+	dataSetName := ctx.String("dataset")
+
+	repo, err := LoadRepo()
+	if err != nil {
+		return err
+	}
+	before, err := repo.Clone()
+	if err != nil {
+		return err
+	}
+
+	if link && repo.Mirrors.Get(name) == nil {
+		return fmt.Errorf("mirror %s not found", name)
+	}
+	dataSet := repo.DataSets.GetDataset(dataSetName)
+	if dataSet == nil {
+		return fmt.Errorf("dataset %s not found", dataSetName)
+	}
+
+	update := func(names []string) []string {
+		if link {
+			return appendUnique(names, name)
+		}
+		return removeString(names, name)
+	}
+	if ctx.IsSet("pieceCid") {
+		for _, pieceCid := range strings.Split(ctx.String("pieceCid"), ",") {
+			piece := dataSet.Get(strings.TrimSpace(pieceCid))
+			if piece == nil {
+				return fmt.Errorf("piece %s not found in dataset %s", pieceCid, dataSetName)
+			}
+			piece.Mirrors = update(piece.Mirrors)
+		}
+	} else {
+		dataSet.Mirrors = update(dataSet.Mirrors)
+	}
+
+	if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+		return err
+	}
+	fmt.Printf("%s mirror %s success!\n", ctx.Command.Name, name)
+	return nil
+}
+
+// removeString 返回去掉 s 之后的 list
+func removeString(list []string, s string) []string {
+	var out []string
+	for _, v := range list {
+		if v != s {
+			out = append(out, v)
+		}
+	}
+	return out
+}
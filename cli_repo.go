@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/liushuochen/gotable"
+	"github.com/urfave/cli/v2"
+)
+
+var repoManager = &cli.Command{
+	Name:  "repo",
+	Usage: "repo snapshot manager",
+	Subcommands: []*cli.Command{
+		repoHistory,
+		repoDiff,
+		repoRestore,
+		repoPrune,
+	},
+}
+
+var repoHistory = &cli.Command{
+	Name:  "history",
+	Usage: "list repo snapshots",
+	Action: func(ctx *cli.Context) error {
+		snaps, err := ListSnapshots()
+		if err != nil {
+			return err
+		}
+
+		table, err := gotable.Create("snapshot", "time", "command", "orgs", "dataSets")
+		if err != nil {
+			return err
+		}
+		for _, snap := range snaps {
+			repo, err := LoadSnapshot(snap.ID)
+			if err != nil {
+				return err
+			}
+			table.AddRow([]string{snap.ID, snap.Time.Format(time.RFC3339), snap.Command, strconv.Itoa(len(repo.Users.List)), strconv.Itoa(len(repo.DataSets.List))})
+		}
+		fmt.Println(table)
+		return nil
+	},
+}
+
+var repoDiff = &cli.Command{
+	Name:      "diff",
+	Usage:     "show the changes from a snapshot to the current repo",
+	ArgsUsage: "<snapshot>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "diff-format",
+			Usage: "output format: table or json",
+			Value: "table",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify a snapshot")
+		}
+		snap, err := LoadSnapshot(ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		return DiffRepo(snap, repo).Print(os.Stdout, ctx.String("diff-format"))
+	},
+}
+
+var repoRestore = &cli.Command{
+	Name:      "restore",
+	Usage:     "restore the repo to a snapshot, the current state is snapshotted first",
+	ArgsUsage: "<snapshot>",
+	Flags: append([]cli.Flag{
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "must be specified for the action to take effect",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		if ctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify a snapshot")
+		}
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
+			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
+		}
+		id := ctx.Args().First()
+		snap, err := LoadSnapshot(id)
+		if err != nil {
+			return err
+		}
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		// 分配id不能回退，否则恢复后新的分配会和已经导出的分配id重复
+		if repo.Allocations.NextID > snap.Allocations.NextID {
+			snap.Allocations.NextID = repo.Allocations.NextID
+		}
+
+		if ok, err := commitRepo(ctx, repo, snap); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("restore snapshot %s success!\n", id)
+		return nil
+	},
+}
+
+var repoPrune = &cli.Command{
+	Name:  "prune",
+	Usage: "remove snapshots by the retention policy",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "keep",
+			Usage: "number of snapshots to keep, default use --snapshot-keep",
+		},
+		&cli.DurationFlag{
+			Name:  "max-age",
+			Usage: "remove snapshots older than this, default use --snapshot-max-age",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		keep, maxAge := snapshotKeep, snapshotMaxAge
+		if ctx.IsSet("keep") {
+			keep = ctx.Int("keep")
+		}
+		if ctx.IsSet("max-age") {
+			maxAge = ctx.Duration("max-age")
+		}
+		return PruneSnapshots(keep, maxAge)
+	},
+}
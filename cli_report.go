@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+var reportManager = &cli.Command{
+	Name:  "report",
+	Usage: "dataset progress reports",
+	Subcommands: []*cli.Command{
+		reportProgress,
+		reportRecord,
+	},
+}
+
+var reportProgress = &cli.Command{
+	Name:  "progress",
+	Usage: "show the daily replication progress of a dataset",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "name",
+			Usage:    "specify dataSet name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "since",
+			Usage: "specify the start of the report, e.g. 90d, 12w, 720h or 2006-01-02",
+			Value: "90d",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: csv, json or svg",
+			Value: "csv",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		since, err := parseSince(ctx.String("since"))
+		if err != nil {
+			return err
+		}
+		history, err := ReadHistory()
+		if err != nil {
+			return err
+		}
+		series := history.Series(ctx.String("name"), since, time.Now())
+		if len(series) == 0 {
+			return fmt.Errorf("no history of dataset %s, it is recorded after each change or by 'dist report record'", ctx.String("name"))
+		}
+		return WriteProgress(os.Stdout, ctx.String("format"), ctx.String("name"), series)
+	},
+}
+
+var reportRecord = &cli.Command{
+	Name:  "record",
+	Usage: "record today's progress of all datasets, run it daily e.g. from cron to keep the history continuous",
+	Action: func(ctx *cli.Context) error {
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		if err := RecordHistory(repo, time.Now()); err != nil {
+			return err
+		}
+		fmt.Println("record progress success!")
+		return nil
+	},
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/liushuochen/gotable"
+	"github.com/urfave/cli/v2"
+)
+
+var spManager = &cli.Command{
+	Name:  "sp",
+	Usage: "storage provider manager",
+	Subcommands: []*cli.Command{
+		spView,
+		spShow,
+		spAdd,
+		spSet,
+		spDisable,
+	},
+}
+
+// spAttrFlags sp add 和 sp set 共用的属性参数
+var spAttrFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "region",
+		Usage: "specify sp region, used to pick the nearest mirror, e.g. asia-east",
+	},
+	&cli.StringFlag{
+		Name:  "location",
+		Usage: "specify sp location, e.g. Hong Kong",
+	},
+	&cli.StringFlag{
+		Name:  "contact",
+		Usage: "specify sp contact, e.g. email or slack id",
+	},
+	&cli.Int64Flag{
+		Name:  "sector-size",
+		Usage: "specify sp sector size(GiB), e.g. 32 or 64",
+	},
+	&cli.Float64Flag{
+		Name:  "max-daily-ingest",
+		Usage: "specify the max pieceSize(TiB) the sp can receive per 24 hours, 0 is unlimited",
+	},
+	&cli.Float64Flag{
+		Name:  "weight",
+		Usage: "specify sp weight when splitting a size among the sps of its org, default 1",
+	},
+	&cli.StringFlag{
+		Name:  "retrieval",
+		Usage: "specify sp retrieval endpoint",
+	},
+	&cli.StringFlag{
+		Name:  "status",
+		Usage: "specify sp status: onboarding, active, paused or banned",
+	},
+	&cli.StringFlag{
+		Name:  "reason",
+		Usage: "why the sp is paused or banned",
+	},
+}
+
+// applySpAttrs 把命令行中指定的属性写入 p，没有指定的保持不变
+func applySpAttrs(ctx *cli.Context, p *Provider) error {
+	if ctx.IsSet("status") {
+		status := ctx.String("status")
+		if !ValidSpStatus(status) {
+			return fmt.Errorf("unknown sp status %s, must be one of %s, %s, %s, %s", status, SpOnboarding, SpActive, SpPaused, SpBanned)
+		}
+		p.Status = status
+		if status == SpOnboarding || status == SpActive {
+			p.StatusReason = ""
+		}
+	}
+	if ctx.IsSet("reason") {
+		p.StatusReason = ctx.String("reason")
+	}
+	if ctx.Float64("max-daily-ingest") < 0 {
+		return fmt.Errorf("--max-daily-ingest must not be negative")
+	}
+	if ctx.Float64("weight") < 0 {
+		return fmt.Errorf("--weight must not be negative")
+	}
+	if ctx.Int64("sector-size") < 0 {
+		return fmt.Errorf("--sector-size must not be negative")
+	}
+	if ctx.IsSet("region") {
+		p.Region = ctx.String("region")
+	}
+	if ctx.IsSet("location") {
+		p.Location = ctx.String("location")
+	}
+	if ctx.IsSet("contact") {
+		p.Contact = ctx.String("contact")
+	}
+	if ctx.IsSet("sector-size") {
+		p.SectorSize = ctx.Int64("sector-size") << 30
+	}
+	if ctx.IsSet("max-daily-ingest") {
+		p.MaxDailyIngest = ctx.Float64("max-daily-ingest")
+	}
+	if ctx.IsSet("weight") {
+		p.Weight = ctx.Float64("weight")
+	}
+	if ctx.IsSet("retrieval") {
+		p.RetrievalEndpoint = ctx.String("retrieval")
+	}
+	return nil
+}
+
+var spView = &cli.Command{
+	Name:  "view",
+	Usage: "view all sps",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "org",
+			Usage: "only view the sps of the org",
+		},
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "use json output",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+
+		type spRow struct {
+			Org string `json:"org"`
+			*Provider
+		}
+		var rows []spRow
+		for _, user := range repo.Users.List {
+			if ctx.IsSet("org") && user.Org != ctx.String("org") {
+				continue
+			}
+			for _, p := range user.Providers {
+				rows = append(rows, spRow{Org: user.Org, Provider: p})
+			}
+		}
+
+		if ctx.Bool("json") {
+			data, err := json.MarshalIndent(rows, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		}
+
+		table, err := gotable.Create("sp", "org", "status", "region", "location", "contact", "sectorSize(GiB)", "maxDailyIngest(TiB)", "weight", "retrieval", "quota")
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			status := row.GetStatus()
+			if row.StatusReason != "" {
+				status += ": " + row.StatusReason
+			}
+			var sectorSize, maxDailyIngest, weight string
+			if row.SectorSize > 0 {
+				sectorSize = strconv.FormatInt(row.SectorSize>>30, 10)
+			}
+			if row.MaxDailyIngest > 0 {
+				maxDailyIngest = strconv.FormatFloat(row.MaxDailyIngest, 'f', -1, 64)
+			}
+			if row.Weight > 0 {
+				weight = strconv.FormatFloat(row.Weight, 'f', -1, 64)
+			}
+			table.AddRow([]string{row.Sp, row.Org, status, row.Region, row.Location, row.Contact, sectorSize, maxDailyIngest, weight, row.RetrievalEndpoint, row.Quota.String()})
+		}
+		fmt.Println(table)
+		return nil
+	},
+}
+
+var spAdd = &cli.Command{
+	Name:  "add",
+	Usage: "add a sp to an org",
+	Flags: append(append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "org",
+			Usage:    "specify org name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "sp",
+			Usage:    "specify a sp",
+			Required: true,
+		},
+	}, spAttrFlags...), dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		org, sp := ctx.String("org"), ctx.String("sp")
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		change, err := repo.Users.AddSp(org, sp)
+		if err != nil {
+			return err
+		}
+		if change == nil {
+			return fmt.Errorf("%s already belongs to org %s, use sp set to change its properties", sp, org)
+		}
+		if err := applySpAttrs(ctx, repo.Users.Get(org).Provider(sp)); err != nil {
+			return err
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("add sp %s to org %s success!\n", sp, org)
+		return nil
+	},
+}
+
+var spSet = &cli.Command{
+	Name:  "set",
+	Usage: "set the properties of a sp",
+	Flags: append(append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "sp",
+			Usage:    "specify a sp",
+			Required: true,
+		},
+	}, spAttrFlags...), dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		sp := ctx.String("sp")
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		user := repo.Users.GetBySp(sp)
+		if user == nil {
+			return fmt.Errorf("%s does not belong to any organization, please add user sp first", sp)
+		}
+		if err := applySpAttrs(ctx, user.Provider(sp)); err != nil {
+			return err
+		}
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("set sp %s success!\n", sp)
+		return nil
+	},
+}
+
+var spDisable = &cli.Command{
+	Name:  "disable",
+	Usage: "pause a sp, no more pieces are allocated to it",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "sp",
+			Usage:    "specify a sp",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "ban",
+			Usage: "ban the sp instead of pausing it",
+		},
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "why the sp is disabled",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		sp := ctx.String("sp")
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		user := repo.Users.GetBySp(sp)
+		if user == nil {
+			return fmt.Errorf("%s does not belong to any organization, please add user sp first", sp)
+		}
+		provider := user.Provider(sp)
+		provider.Status = SpPaused
+		if ctx.Bool("ban") {
+			provider.Status = SpBanned
+		}
+		provider.StatusReason = ctx.String("reason")
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("%s sp %s success!\n", provider.Status, sp)
+		return nil
+	},
+}
+
+var spShow = &cli.Command{
+	Name:      "show",
+	Usage:     "show what a sp has received across all datasets",
+	ArgsUsage: "<sp>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: table, json or csv",
+			Value: "table",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			return fmt.Errorf("please specify one sp")
+		}
+		sp := ctx.Args().First()
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		user := repo.Users.GetBySp(sp)
+		if user == nil {
+			return fmt.Errorf("%s does not belong to any organization", sp)
+		}
+		return NewHolderReport(repo, user, sp, time.Now()).Write(os.Stdout, ctx.String("format"))
+	},
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gh-efforts/distribution/distribution"
+	"github.com/liushuochen/gotable"
+	"github.com/urfave/cli/v2"
+)
+
+var userAddSp = &cli.Command{
+	Name:  "add-sp",
+	Usage: "add sps to a org",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "org",
+			Usage:    "specify org",
+			Required: true,
+			Aliases:  []string{"u"},
+		},
+		&cli.StringFlag{
+			Name:     "sp",
+			Usage:    "specify sp list, sp1,sp2",
+			Required: true,
+			Aliases:  []string{"s"},
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		org := ctx.String("org")
+		return editMembership(ctx, func(users *Users, sp string) (*MembershipChange, error) {
+			return users.AddSp(org, sp)
+		})
+	},
+}
+
+var userRemoveSp = &cli.Command{
+	Name:  "remove-sp",
+	Usage: "remove sps from a org",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "org",
+			Usage:    "specify org",
+			Required: true,
+			Aliases:  []string{"u"},
+		},
+		&cli.StringFlag{
+			Name:     "sp",
+			Usage:    "specify sp list, sp1,sp2",
+			Required: true,
+			Aliases:  []string{"s"},
+		},
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "must be specified for the action to take effect",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
+			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
+		}
+		org := ctx.String("org")
+		return editMembership(ctx, func(users *Users, sp string) (*MembershipChange, error) {
+			return users.RemoveSp(org, sp)
+		})
+	},
+}
+
+var userMoveSp = &cli.Command{
+	Name:  "move-sp",
+	Usage: "move sps from one org to another, their properties are moved too",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "from",
+			Usage:    "specify the org the sps belong to",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "to",
+			Usage:    "specify the org to move the sps to",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "sp",
+			Usage:    "specify sp list, sp1,sp2",
+			Required: true,
+			Aliases:  []string{"s"},
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		from, to := ctx.String("from"), ctx.String("to")
+		return editMembership(ctx, func(users *Users, sp string) (*MembershipChange, error) {
+			return users.MoveSp(from, to, sp)
+		})
+	},
+}
+
+// editMembership 对 --sp 中的每个sp执行 edit，全部成功后一次提交，并输出变化
+func editMembership(ctx *cli.Context, edit func(users *Users, sp string) (*MembershipChange, error)) error {
+	sps := splitList(ctx.String("sp"))
+	if len(sps) == 0 {
+		return fmt.Errorf("--sp must not be empty")
+	}
+
+	repo, err := LoadRepo()
+	if err != nil {
+		return err
+	}
+	before, err := repo.Clone()
+	if err != nil {
+		return err
+	}
+
+	var changes []*MembershipChange
+	for _, sp := range sps {
+		change, err := edit(repo.Users, sp)
+		if err != nil {
+			return err
+		}
+		if change != nil {
+			changes = append(changes, change)
+		}
+	}
+	if err := repo.Users.Validate(); err != nil {
+		return err
+	}
+
+	if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+		return err
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	fmt.Printf("%s %d sps success!\n", ctx.Command.Name, len(changes))
+	return nil
+}
+
+var userOffboard = &cli.Command{
+	Name:  "offboard",
+	Usage: "remove a org that leaves, mark the replicas of its sps as lost and report the affected pieces",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "org",
+			Usage:    "specify org",
+			Required: true,
+			Aliases:  []string{"u"},
+		},
+		&cli.BoolFlag{
+			Name:  "keep",
+			Usage: "keep the replicas counted, e.g. the deals stay active",
+		},
+		&cli.StringFlag{
+			Name:  "plan",
+			Usage: "write a plan to replace the lost replicas to this file, see alloc apply",
+		},
+		&cli.StringFlag{
+			Name:  "replace-sp",
+			Usage: "specify the sp used to replace the lost replicas, required by --plan",
+		},
+		&cli.StringFlag{
+			Name:  "dataset",
+			Usage: "specify the dataset to plan for, required by --plan when more than one dataset is affected",
+		},
+		&cli.StringFlag{
+			Name:  "strategy",
+			Value: distribution.StrategyLeastReplicated,
+			Usage: "specify the allocation strategy of the plan",
+		},
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "must be specified for the action to take effect",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		org := ctx.String("org")
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
+			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
+		}
+		if ctx.IsSet("plan") && ctx.Bool("keep") {
+			return fmt.Errorf("nothing to replace with --keep")
+		}
+		if ctx.IsSet("plan") && !ctx.IsSet("replace-sp") {
+			return fmt.Errorf("--replace-sp is required by --plan")
+		}
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		user := repo.Users.Get(org)
+		if user == nil {
+			return fmt.Errorf("org %s not found", org)
+		}
+		report := repo.MarkLost(user.Sps(), !ctx.Bool("keep"))
+		repo.Users.Delete(org)
+
+		var lost *LostReplicas
+		if ctx.IsSet("plan") {
+			name := ctx.String("dataset")
+			if name == "" && len(report) == 1 {
+				name = report[0].DataSetName
+			}
+			if name == "" {
+				return fmt.Errorf("%d datasets are affected, please specify one with --dataset", len(report))
+			}
+			for _, r := range report {
+				if r.DataSetName == name {
+					lost = r
+				}
+			}
+			if lost == nil {
+				return fmt.Errorf("dataset %s is not affected", name)
+			}
+		}
+
+		table, err := gotable.Create("dataSetName", "pieces", "replicas", "pieceSize(TiB)", "action")
+		if err != nil {
+			return err
+		}
+		action := "lost"
+		if ctx.Bool("keep") {
+			action = "kept"
+		}
+		for _, r := range report {
+			table.AddRow([]string{r.DataSetName, strconv.Itoa(r.Pieces), strconv.Itoa(r.Replicas), strconv.FormatFloat(float64(r.PieceSize)/(1<<40), 'f', -1, 64), action})
+		}
+		fmt.Println(table)
+
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("offboard %s success!\n", org)
+
+		if lost == nil {
+			return nil
+		}
+		work, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+		params := &AllocParams{
+			DataSetName: lost.DataSetName,
+			Sp:          ctx.String("replace-sp"),
+			Size:        lost.PieceSize,
+			Fit:         repoConfig.Defaults.Fit,
+			Strategy:    ctx.String("strategy"),
+		}
+		alloc, _, err := allocate(ctx, work, params, os.Stderr)
+		if err != nil {
+			return fmt.Errorf("plan replacement: %w", err)
+		}
+		plan, err := NewPlan(repo, params, alloc)
+		if err != nil {
+			return err
+		}
+		if err := WritePlan(ctx.String("plan"), plan); err != nil {
+			return err
+		}
+		fmt.Printf("plan with %d pieces (%vTiB) written to %s, apply it with: dist alloc apply %s\n", len(plan.Pieces), float64(plan.PieceSize)/(1<<40), ctx.String("plan"), ctx.String("plan"))
+		return nil
+	},
+}
+
+var userImport = &cli.Command{
+	Name:      "import",
+	Usage:     "import org and sp membership from a csv or json roster, empty properties are left unchanged, see user export for the format",
+	ArgsUsage: "<roster file>",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "roster format: csv or json, default by the file extension",
+		},
+		&cli.BoolFlag{
+			Name:  "prune",
+			Usage: "also remove the sps not in the roster",
+		},
+		&cli.BoolFlag{
+			Name:  "really-do-it",
+			Usage: "must be specified for the action to take effect",
+		},
+	}, dryRunFlags...),
+	Action: func(ctx *cli.Context) error {
+		if ctx.NArg() != 1 {
+			return fmt.Errorf("please specify one roster file")
+		}
+		file := ctx.Args().First()
+		format := ctx.String("format")
+		if format == "" {
+			format = strings.TrimPrefix(filepath.Ext(file), ".")
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		roster, err := ReadRoster(f, format)
+		if err != nil {
+			return err
+		}
+
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		before, err := repo.Clone()
+		if err != nil {
+			return err
+		}
+
+		changes, err := ApplyRoster(repo.Users, roster, ctx.Bool("prune"))
+		if err != nil {
+			return err
+		}
+		if changes.IsEmpty() {
+			fmt.Println("nothing to import")
+			return nil
+		}
+		for _, org := range changes.Orgs {
+			fmt.Printf("+ org %s\n", org)
+		}
+		for _, change := range changes.Membership {
+			fmt.Println(change)
+		}
+		for _, sp := range changes.Updated {
+			fmt.Printf("* %s properties updated\n", sp)
+		}
+
+		if !ctx.Bool("really-do-it") && !ctx.Bool("dry-run") {
+			return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
+		}
+		if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+			return err
+		}
+		fmt.Printf("import %d entries success!\n", len(roster))
+		return nil
+	},
+}
+
+var userExport = &cli.Command{
+	Name:  "export",
+	Usage: "export org and sp membership as a csv or json roster",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "roster format: csv or json",
+			Value: "csv",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		return WriteRoster(os.Stdout, ctx.String("format"), ExportRoster(repo.Users))
+	},
+}
+
+var userShow = &cli.Command{
+	Name:  "show",
+	Usage: "show what the sps of a org have received across all datasets",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "org",
+			Usage:    "specify org",
+			Required: true,
+			Aliases:  []string{"u"},
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Usage: "output format: table, json or csv",
+			Value: "table",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		repo, err := LoadRepo()
+		if err != nil {
+			return err
+		}
+		user := repo.Users.Get(ctx.String("org"))
+		if user == nil {
+			return fmt.Errorf("org %s not found", ctx.String("org"))
+		}
+		return NewHolderReport(repo, user, "", time.Now()).Write(os.Stdout, ctx.String("format"))
+	},
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gh-efforts/distribution/distribution"
+	"github.com/urfave/cli/v2"
+)
+
+var configFile string
+
+// repoConfig 仓库配置，Before 中从 configFile 读取
+var repoConfig = DefaultConfig()
+
+// Config 仓库配置文件 <repo>/config.toml，优先级: 命令行参数 > 环境变量 > 配置文件 > 内置默认值
+type Config struct {
+	Defaults ConfigDefaults `toml:"defaults"`
+	Deal     ConfigDeal     `toml:"deal"`
+	Policy   ConfigPolicy   `toml:"policy"`
+	Mirrors  ConfigMirrors  `toml:"mirrors"`
+	// org 没有设置配额时使用的配额
+	Quota    Quota          `toml:"quota"`
+	Snapshot ConfigSnapshot `toml:"snapshot"`
+}
+
+type ConfigDefaults struct {
+	// dataset add 的默认副本数
+	Duplicate int `toml:"duplicate"`
+	Repeat    int `toml:"repeat"`
+	// over 或 under，见 distribution.Fit
+	Fit    string `toml:"fit"`
+	Prefix string `toml:"prefix"`
+	Suffix string `toml:"suffix"`
+	// dataset get 的输出格式
+	Output string `toml:"output"`
+	// alloc export 的输出格式
+	ExportFormat string `toml:"export_format"`
+	AllMirrors   bool   `toml:"all_mirrors"`
+}
+
+type ConfigDeal struct {
+	Verified   bool  `toml:"verified"`
+	StartDelay int   `toml:"start_delay"`
+	Duration   int64 `toml:"duration"`
+}
+
+type ConfigPolicy struct {
+	WarnBelow  float64 `toml:"warn_below"`
+	CheckChain bool    `toml:"check_chain"`
+	// 为 false 时不允许使用 --override-quota
+	AllowOverrideQuota bool `toml:"allow_override_quota"`
+	// 单次 dataset get 最多分配的pieceSize(TiB)，0表示不限制
+	MaxSizePerGet float64 `toml:"max_size_per_get"`
+}
+
+type ConfigMirrors struct {
+	// 数据集和piece都没有指定下载源时使用
+	Default []string `toml:"default"`
+}
+
+type ConfigSnapshot struct {
+	Keep int `toml:"keep"`
+	// 例如 2160h，为空表示不按时间清理
+	MaxAge string `toml:"max_age"`
+}
+
+// DefaultConfig 返回内置默认值，与命令行参数的默认值相同
+func DefaultConfig() *Config {
+	return &Config{
+		Defaults: ConfigDefaults{Fit: string(distribution.FitOver), Suffix: ".car", Output: "url", ExportFormat: "boost"},
+		Deal:     ConfigDeal{Verified: true, StartDelay: 7, Duration: 1468800},
+		Policy:   ConfigPolicy{WarnBelow: 0.1, AllowOverrideQuota: true},
+		Snapshot: ConfigSnapshot{Keep: 100},
+	}
+}
+
+// LoadConfig 读取配置文件，文件不存在时用内置默认值创建
+func LoadConfig(file string) (*Config, error) {
+	cfg := DefaultConfig()
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return cfg, cfg.Write(file)
+	}
+	md, err := toml.DecodeFile(file, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("read config %s: %w", file, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("read config %s: unknown key %s", file, undecoded[0])
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("read config %s: %w", file, err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) Write(file string) error {
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+		return err
+	}
+	return os.WriteFile(file, buf.Bytes(), 0644)
+}
+
+func (c *Config) Validate() error {
+	if _, ok := outputWriters[c.Defaults.Output]; !ok {
+		return fmt.Errorf("defaults.output: unknown output format %s, must be one of %s", c.Defaults.Output, outputFormats())
+	}
+	if _, ok := outputWriters[c.Defaults.ExportFormat]; !ok {
+		return fmt.Errorf("defaults.export_format: unknown output format %s, must be one of %s", c.Defaults.ExportFormat, outputFormats())
+	}
+	if fit := distribution.Fit(c.Defaults.Fit); fit != distribution.FitOver && fit != distribution.FitUnder {
+		return fmt.Errorf("defaults.fit must be %s or %s", distribution.FitOver, distribution.FitUnder)
+	}
+	if c.Policy.WarnBelow < 0 || c.Policy.WarnBelow > 1 {
+		return fmt.Errorf("policy.warn_below must be between 0 and 1")
+	}
+	if c.Quota.MaxDataSetShare < 0 || c.Quota.MaxDataSetShare > 1 {
+		return fmt.Errorf("quota.max_share must be between 0 and 1")
+	}
+	if _, err := c.SnapshotMaxAge(); err != nil {
+		return fmt.Errorf("snapshot.max_age: %w", err)
+	}
+	return nil
+}
+
+func (c *Config) SnapshotMaxAge() (time.Duration, error) {
+	if c.Snapshot.MaxAge == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.Snapshot.MaxAge)
+}
+
+// flagDefaults 配置项对应的命令行参数，key 为命令名
+func (c *Config) flagDefaults() map[string]map[string]interface{} {
+	deal := map[string]interface{}{
+		"verified":    c.Deal.Verified,
+		"start-delay": c.Deal.StartDelay,
+		"duration":    c.Deal.Duration,
+	}
+	get := map[string]interface{}{
+		"repeat":      c.Defaults.Repeat,
+		"fit":         c.Defaults.Fit,
+		"prefix":      c.Defaults.Prefix,
+		"suffix":      c.Defaults.Suffix,
+		"output":      c.Defaults.Output,
+		"all-mirrors": c.Defaults.AllMirrors,
+		"warn-below":  c.Policy.WarnBelow,
+		"check-chain": c.Policy.CheckChain,
+	}
+	export := map[string]interface{}{
+		"prefix":      c.Defaults.Prefix,
+		"suffix":      c.Defaults.Suffix,
+		"format":      c.Defaults.ExportFormat,
+		"all-mirrors": c.Defaults.AllMirrors,
+	}
+	for k, v := range deal {
+		get[k] = v
+		export[k] = v
+	}
+	return map[string]map[string]interface{}{
+		"dataset add":  {"duplicate": c.Defaults.Duplicate},
+		"dataset get":  get,
+		"alloc export": export,
+		"client view":  {"warn-below": c.Policy.WarnBelow},
+	}
+}
+
+// ApplyFlagDefaults 用配置替换命令行参数的默认值。在解析子命令参数之前调用，之后命令行参数和环境变量仍然会覆盖它
+func (c *Config) ApplyFlagDefaults(commands []*cli.Command) {
+	defaults := c.flagDefaults()
+	var walk func(prefix string, commands []*cli.Command)
+	walk = func(prefix string, commands []*cli.Command) {
+		for _, cmd := range commands {
+			name := strings.TrimSpace(prefix + " " + cmd.Name)
+			for _, flag := range cmd.Flags {
+				for _, flagName := range flag.Names() {
+					if v, ok := defaults[name][flagName]; ok {
+						setFlagDefault(flag, v)
+					}
+				}
+			}
+			walk(name, cmd.Subcommands)
+		}
+	}
+	walk("", commands)
+}
+
+// setFlagDefault 设置参数默认值，同一个配置项在不同命令中可能是 int 或 int64
+func setFlagDefault(flag cli.Flag, v interface{}) {
+	value := reflect.ValueOf(v)
+	switch f := flag.(type) {
+	case *cli.StringFlag:
+		f.Value = value.String()
+	case *cli.IntFlag:
+		f.Value = int(value.Int())
+	case *cli.Int64Flag:
+		f.Value = value.Int()
+	case *cli.Float64Flag:
+		f.Value = value.Float()
+	case *cli.BoolFlag:
+		f.Value = value.Bool()
+	}
+}
+
+// field 按 section.key 找到配置项
+func (c *Config) field(key string) (reflect.Value, error) {
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("unknown config key %s", key)
+		}
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if tag := strings.Split(v.Type().Field(i).Tag.Get("toml"), ",")[0]; tag == name {
+				v = v.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown config key %s", key)
+		}
+	}
+	if v.Kind() == reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("%s is a section, please specify a key in it", key)
+	}
+	return v, nil
+}
+
+// Get 返回配置项的值，列表用逗号分隔
+func (c *Config) Get(key string) (string, error) {
+	v, err := c.field(key)
+	if err != nil {
+		return "", err
+	}
+	if v.Kind() == reflect.Slice {
+		return strings.Join(v.Interface().([]string), ","), nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
+
+// Set 设置配置项，列表用逗号分隔
+func (c *Config) Set(key, value string) error {
+	v, err := c.field(key)
+	if err != nil {
+		return err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetInt(i)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		v.Set(reflect.ValueOf(splitList(value)))
+	default:
+		return fmt.Errorf("unsupported config key %s", key)
+	}
+	return c.Validate()
+}
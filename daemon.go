@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gh-efforts/distribution/distribution"
+	"github.com/urfave/cli/v2"
+)
+
+//go:embed web
+var webFiles embed.FS
+
+var daemonCmd = &cli.Command{
+	Name:  "daemon",
+	Usage: "serve the web dashboard and its api, read-only unless --token is set",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "specify the listen address",
+			Value: "127.0.0.1:8090",
+		},
+		&cli.StringFlag{
+			Name:    "token",
+			Usage:   "allow creating allocations with 'Authorization: Bearer <token>', default read-only",
+			EnvVars: []string{"DIST_DAEMON_TOKEN"},
+		},
+		&cli.Float64Flag{
+			Name:  "warn-below",
+			Usage: "warn when a client has less than this share(0-1) of its DataCap left",
+			Value: 0.1,
+		},
+		lotusApiFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		static, err := fs.Sub(webFiles, "web")
+		if err != nil {
+			return err
+		}
+		d := &daemon{ctx: ctx, token: ctx.String("token")}
+		mux := http.NewServeMux()
+		mux.Handle("/", http.FileServer(http.FS(static)))
+		mux.HandleFunc("/api/info", d.handleInfo)
+		mux.HandleFunc("/api/datasets", d.handleDataSets)
+		mux.HandleFunc("/api/datasets/", d.handleDataSet)
+		mux.HandleFunc("/api/orgs", d.handleOrgs)
+		mux.HandleFunc("/api/orgs/", d.handleOrg)
+		mux.HandleFunc("/api/sps", d.handleSps)
+		mux.HandleFunc("/api/sps/", d.handleSp)
+		mux.HandleFunc("/api/allocations", d.handleAllocations)
+		mux.HandleFunc("/api/compliance", d.handleCompliance)
+
+		mode := "read-only"
+		if d.token != "" {
+			mode = "allocations enabled"
+		}
+		log.Printf("serving %s on http://%s (%s)", repoDir, ctx.String("listen"), mode)
+		return http.ListenAndServe(ctx.String("listen"), mux)
+	},
+}
+
+// daemon 的每个请求都重新读取仓库，并持有与命令行相同的文件锁，命令行和 daemon 可以同时使用
+type daemon struct {
+	ctx   *cli.Context
+	token string
+}
+
+// apiError 带 http 状态码的错误
+type apiError struct {
+	status int
+	err    error
+}
+
+func (e *apiError) Error() string { return e.err.Error() }
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write response: %v", err)
+	}
+}
+
+// serve 加锁读取仓库后调用 fn，把结果或错误写成json
+func (d *daemon) serve(w http.ResponseWriter, r *http.Request, method string, fn func(repo *Repo) (interface{}, error)) {
+	if r.Method != method {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	lock, err := lockRepo(true)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	defer lock.Close()
+
+	repo, err := LoadRepo()
+	if err == nil {
+		var v interface{}
+		if v, err = fn(repo); err == nil {
+			writeJSON(w, http.StatusOK, v)
+			return
+		}
+	}
+	status := http.StatusBadRequest
+	if e, ok := err.(*apiError); ok {
+		status = e.status
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func notFound(format string, a ...interface{}) error {
+	return &apiError{status: http.StatusNotFound, err: fmt.Errorf(format, a...)}
+}
+
+// pathParam 返回 /api/xxx/ 之后的部分
+func pathParam(r *http.Request, prefix string) []string {
+	return strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, prefix), "/"), "/")
+}
+
+func (d *daemon) handleInfo(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+		return map[string]interface{}{
+			"version":    UserVersion(),
+			"readOnly":   d.token == "",
+			"strategies": distribution.StrategyNames(),
+			"summary":    SummarizeRepo(repo),
+		}, nil
+	})
+}
+
+// dataSetOverview 数据集列表中的一项
+type dataSetOverview struct {
+	*DataSetStats
+	Status     string `json:"status"`
+	ClientName string `json:"clientName,omitempty"`
+}
+
+func (d *daemon) handleDataSets(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+		out := []*dataSetOverview{}
+		for _, dataSet := range repo.DataSets.List {
+			out = append(out, &dataSetOverview{DataSetStats: NewDataSetStats(dataSet, repo.Users), Status: dataSet.GetStatus(), ClientName: dataSet.ClientName})
+		}
+		return out, nil
+	})
+}
+
+// handleDataSet /api/datasets/<name> 返回统计，/api/datasets/<name>/pieces 返回全部piece
+func (d *daemon) handleDataSet(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+		params := pathParam(r, "/api/datasets/")
+		dataSet := repo.DataSets.GetDataset(params[0])
+		if dataSet == nil {
+			return nil, notFound("dataset %s not found", params[0])
+		}
+		if len(params) > 1 && params[1] == "pieces" {
+			return dataSet.Pieces, nil
+		}
+		return &dataSetOverview{DataSetStats: NewDataSetStats(dataSet, repo.Users), Status: dataSet.GetStatus(), ClientName: dataSet.ClientName}, nil
+	})
+}
+
+func (d *daemon) handleOrgs(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+		out := []*HolderReport{}
+		for _, user := range repo.Users.List {
+			out = append(out, NewHolderReport(repo, user, "", time.Now()))
+		}
+		return out, nil
+	})
+}
+
+func (d *daemon) handleOrg(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+		org := pathParam(r, "/api/orgs/")[0]
+		user := repo.Users.Get(org)
+		if user == nil {
+			return nil, notFound("org %s not found", org)
+		}
+		return NewHolderReport(repo, user, "", time.Now()), nil
+	})
+}
+
+func (d *daemon) handleSps(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+		out := ExportRoster(repo.Users)
+		if out == nil {
+			out = []*RosterEntry{}
+		}
+		return out, nil
+	})
+}
+
+func (d *daemon) handleSp(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+		sp := pathParam(r, "/api/sps/")[0]
+		user := repo.Users.GetBySp(sp)
+		if user == nil {
+			return nil, notFound("%s does not belong to any organization", sp)
+		}
+		return NewHolderReport(repo, user, sp, time.Now()), nil
+	})
+}
+
+// allocateRequest POST /api/allocations 的请求，Params.Size 的单位为 bytes
+type allocateRequest struct {
+	Params *AllocParams `json:"params"`
+	// 只返回会分配的piece，不修改仓库
+	DryRun bool `json:"dryRun"`
+}
+
+// allocateResponse POST /api/allocations 的结果，dry run 或者没有分配到piece时 Allocation.ID 为0，不修改仓库
+type allocateResponse struct {
+	Allocation *Allocation `json:"allocation"`
+	DryRun     bool        `json:"dryRun"`
+	// 没有可以分配的piece，原因可能在 Warnings 中
+	NoPieces bool `json:"noPieces,omitempty"`
+	// 配额、DataCap 等限制了分配大小时的提示
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// handleAllocations GET 返回全部分配记录，POST 与 dataset get 相同地分配piece，需要 token
+func (d *daemon) handleAllocations(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+			out := repo.Allocations.List
+			if out == nil {
+				out = []*Allocation{}
+			}
+			return out, nil
+		})
+		return
+	}
+
+	d.serve(w, r, http.MethodPost, func(repo *Repo) (interface{}, error) {
+		if err := d.authorize(r); err != nil {
+			return nil, err
+		}
+		req := new(allocateRequest)
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			return nil, fmt.Errorf("invalid request: %w", err)
+		}
+		params := req.Params
+		if params == nil {
+			return nil, fmt.Errorf("invalid request: missing params")
+		}
+		if err := prepareAllocParams(repo, params); err != nil {
+			return nil, err
+		}
+
+		before, err := repo.Clone()
+		if err != nil {
+			return nil, err
+		}
+		var warn bytes.Buffer
+		alloc, _, err := allocate(d.ctx, repo, params, &warn)
+		if err != nil {
+			return nil, err
+		}
+		resp := &allocateResponse{Allocation: alloc, DryRun: req.DryRun, NoPieces: len(alloc.Pieces) == 0, Warnings: splitLines(warn.String())}
+		if resp.DryRun || resp.NoPieces {
+			alloc.ID = 0
+			return resp, nil
+		}
+		args := []string{"remote=" + r.RemoteAddr, "dataset=" + params.DataSetName, "sp=" + params.Sp, "size=" + strconv.FormatInt(params.Size, 10)}
+		if err := saveRepo("dist daemon allocate", args, params.OverrideQuota, before, repo); err != nil {
+			return nil, &apiError{status: http.StatusInternalServerError, err: err}
+		}
+		log.Printf("allocation %d: %d pieces of %s to %s", alloc.ID, len(alloc.Pieces), alloc.DataSetName, alloc.Sp)
+		return resp, nil
+	})
+}
+
+// splitLines 按行分隔，去掉空行
+func splitLines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+// authorize 没有设置 token 时 daemon 是只读的
+func (d *daemon) authorize(r *http.Request) error {
+	if d.token == "" {
+		return &apiError{status: http.StatusForbidden, err: fmt.Errorf("the daemon is read-only, start it with --token to allow allocations")}
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(d.token)) != 1 {
+		return &apiError{status: http.StatusUnauthorized, err: fmt.Errorf("invalid token")}
+	}
+	return nil
+}
+
+// ComplianceReport 审计日志是否完整，以及需要关注的分配
+type ComplianceReport struct {
+	AuditEntries int `json:"auditEntries"`
+	// 审计日志的哈希链校验结果，为空表示通过
+	AuditError string `json:"auditError,omitempty"`
+	// 越过配额的分配记录
+	Overrides []int64  `json:"overrides"`
+	Warnings  []string `json:"warnings"`
+}
+
+func (d *daemon) handleCompliance(w http.ResponseWriter, r *http.Request) {
+	d.serve(w, r, http.MethodGet, func(repo *Repo) (interface{}, error) {
+		report := &ComplianceReport{Overrides: []int64{}, Warnings: []string{}}
+		entries, err := ReadAuditLog()
+		if err != nil {
+			return nil, err
+		}
+		report.AuditEntries = len(entries)
+		if err := VerifyAuditLog(entries); err != nil {
+			report.AuditError = err.Error()
+		}
+		for _, alloc := range repo.Allocations.List {
+			if alloc.Override {
+				report.Overrides = append(report.Overrides, alloc.ID)
+			}
+		}
+		for _, user := range repo.Users.List {
+			quota := user.Quota
+			if quota.IsZero() {
+				quota = &repoConfig.Quota
+			}
+			if n := repo.Allocations.Outstanding(user.Sps()); quota.MaxOutstanding > 0 && n >= quota.MaxOutstanding {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("org %s has %d unconfirmed allocations, max %d", user.Org, n, quota.MaxOutstanding))
+			}
+			for _, p := range user.Providers {
+				if err := p.CanAllocate(); err != nil {
+					if n := repo.Allocations.Outstanding([]string{p.Sp}); n > 0 {
+						report.Warnings = append(report.Warnings, fmt.Sprintf("%v but has %d unconfirmed allocations", err, n))
+					}
+				}
+			}
+		}
+		for _, dataSet := range repo.DataSets.List {
+			for _, client := range dataSet.Clients {
+				if warning := DataCapWarning(client, d.ctx.Float64("warn-below")); warning != "" {
+					report.Warnings = append(report.Warnings, fmt.Sprintf("dataset %s: %s", dataSet.DataSetName, warning))
+				}
+			}
+		}
+		return report, nil
+	})
+}
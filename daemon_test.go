@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+// writeTestRepo 把 repo 写到临时的仓库目录
+func writeTestRepo(t *testing.T, repo *Repo) {
+	t.Helper()
+	repoDir = t.TempDir()
+	orgsJson = path.Join(repoDir, "users.json")
+	dataSetsJson = path.Join(repoDir, "datasets.json")
+	allocationsJson = path.Join(repoDir, "allocations.json")
+	mirrorsJson = path.Join(repoDir, "mirrors.json")
+	if err := repo.Save(nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDaemonAllocate(t *testing.T) {
+	cases := []struct {
+		name     string
+		token    string
+		auth     string
+		body     string
+		status   int
+		dryRun   bool
+		noPieces bool
+		pieces   int
+		id       int64
+		warnings bool
+	}{
+		{name: "read-only", body: `{"params":{"dataSetName":"d1","sp":"f9","size":1099511627776}}`, status: http.StatusForbidden},
+		{name: "invalid token", token: "secret", auth: "Bearer wrong", body: `{"params":{"dataSetName":"d1","sp":"f9","size":1099511627776}}`, status: http.StatusUnauthorized},
+		{name: "missing params", token: "secret", auth: "Bearer secret", body: `{}`, status: http.StatusBadRequest},
+		{name: "unknown dataset", token: "secret", auth: "Bearer secret", body: `{"params":{"dataSetName":"none","sp":"f9","size":1099511627776}}`, status: http.StatusBadRequest},
+		{name: "dry run", token: "secret", auth: "Bearer secret", body: `{"params":{"dataSetName":"d1","sp":"f9","size":1099511627776},"dryRun":true}`, status: http.StatusOK, dryRun: true, pieces: 1},
+		{name: "allocate", token: "secret", auth: "Bearer secret", body: `{"params":{"dataSetName":"d1","sp":"f9","size":1099511627776}}`, status: http.StatusOK, pieces: 1, id: 4},
+		// d2 唯一的piece已经由 f9 持有，不是 dry run 也不记录分配；org o 的周配额只剩1TiB
+		{name: "no pieces", token: "secret", auth: "Bearer secret", body: `{"params":{"dataSetName":"d2","sp":"f1","size":2199023255552}}`, status: http.StatusOK, noPieces: true, warnings: true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			writeTestRepo(t, newTestRepo(time.Now()))
+			d := &daemon{ctx: cli.NewContext(cli.NewApp(), flag.NewFlagSet("test", flag.ContinueOnError), nil), token: c.token}
+
+			r := httptest.NewRequest(http.MethodPost, "/api/allocations", strings.NewReader(c.body))
+			r.Header.Set("Authorization", c.auth)
+			w := httptest.NewRecorder()
+			d.handleAllocations(w, r)
+			if w.Code != c.status {
+				t.Fatalf("got status %d, want %d: %s", w.Code, c.status, w.Body)
+			}
+			if c.status != http.StatusOK {
+				return
+			}
+
+			resp := new(allocateResponse)
+			if err := json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.DryRun != c.dryRun || resp.NoPieces != c.noPieces || len(resp.Allocation.Pieces) != c.pieces || resp.Allocation.ID != c.id {
+				t.Fatalf("got dryRun %v noPieces %v, %d pieces, id %d", resp.DryRun, resp.NoPieces, len(resp.Allocation.Pieces), resp.Allocation.ID)
+			}
+			if c.warnings != (len(resp.Warnings) > 0) {
+				t.Fatalf("got warnings %v", resp.Warnings)
+			}
+
+			// 只有真正分配时才写入仓库
+			repo, err := LoadRepo()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 3
+			if c.id > 0 {
+				want = 4
+			}
+			if len(repo.Allocations.List) != want {
+				t.Fatalf("got %d allocations in the repo, want %d", len(repo.Allocations.List), want)
+			}
+		})
+	}
+}
+
+func TestDaemonRead(t *testing.T) {
+	writeTestRepo(t, newTestRepo(time.Now()))
+	d := &daemon{}
+	cases := []struct {
+		method  string
+		target  string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{method: http.MethodGet, target: "/api/datasets", handler: d.handleDataSets, status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/datasets/d1", handler: d.handleDataSet, status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/datasets/d1/pieces", handler: d.handleDataSet, status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/datasets/none", handler: d.handleDataSet, status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/api/orgs/o", handler: d.handleOrg, status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/orgs/none", handler: d.handleOrg, status: http.StatusNotFound},
+		{method: http.MethodGet, target: "/api/sps/f9", handler: d.handleSp, status: http.StatusOK},
+		{method: http.MethodGet, target: "/api/sps/f77", handler: d.handleSp, status: http.StatusNotFound},
+		{method: http.MethodDelete, target: "/api/sps", handler: d.handleSps, status: http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		c.handler(w, httptest.NewRequest(c.method, c.target, nil))
+		if w.Code != c.status {
+			t.Errorf("%s %s: got status %d, want %d: %s", c.method, c.target, w.Code, c.status, w.Body)
+		}
+		if !json.Valid(w.Body.Bytes()) {
+			t.Errorf("%s %s: invalid json %s", c.method, c.target, w.Body)
+		}
+	}
+}
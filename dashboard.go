@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/liushuochen/gotable"
+)
+
+// HolderStats 一个sp或org在一个数据集中收到的数据
+type HolderStats struct {
+	DataSetName string `json:"dataSetName"`
+	// 分配记录
+	Allocations     int   `json:"allocations"`
+	AllocatedPieces int   `json:"allocatedPieces"`
+	AllocatedSize   int64 `json:"allocatedSize"`
+	ConfirmedPieces int   `json:"confirmedPieces"`
+	ConfirmedSize   int64 `json:"confirmedSize"`
+	// 数据集中没有丢失的副本
+	ActivePieces int   `json:"activePieces"`
+	ActiveSize   int64 `json:"activeSize"`
+	LostPieces   int   `json:"lostPieces"`
+	// 同一个piece重复发送的次数
+	Repeats        int        `json:"repeats"`
+	LastAllocation *time.Time `json:"lastAllocation,omitempty"`
+}
+
+// HolderReport sp show 和 user show 的结果
+type HolderReport struct {
+	Org      string         `json:"org"`
+	Sps      []string       `json:"sps"`
+	DataSets []*HolderStats `json:"dataSets"`
+	Total    *HolderStats   `json:"total"`
+	// 不考虑数据集占比时剩余的配额(bytes)，-1表示不限制
+	QuotaRemaining int64  `json:"quotaRemaining"`
+	QuotaReason    string `json:"quotaReason,omitempty"`
+}
+
+// NewHolderReport 统计 sps 在全部数据集中收到的数据，sp 为空时统计org的配额
+func NewHolderReport(repo *Repo, user *User, sp string, now time.Time) *HolderReport {
+	sps := user.Sps()
+	if sp != "" {
+		sps = []string{sp}
+	}
+	report := &HolderReport{Org: user.Org, Sps: sps, Total: &HolderStats{DataSetName: "total"}}
+	for _, dataSet := range repo.DataSets.List {
+		stats := &HolderStats{DataSetName: dataSet.DataSetName}
+		for _, piece := range dataSet.Pieces {
+			for _, spInfo := range piece.SpInfos {
+				if !containsString(sps, spInfo.Sp) {
+					continue
+				}
+				if spInfo.Lost {
+					stats.LostPieces++
+					continue
+				}
+				stats.ActivePieces++
+				stats.ActiveSize += piece.PieceSize
+				if spInfo.Num > 1 {
+					stats.Repeats += spInfo.Num - 1
+				}
+			}
+		}
+		for _, alloc := range repo.Allocations.List {
+			if alloc.DataSetName != dataSet.DataSetName || !containsString(sps, alloc.Sp) {
+				continue
+			}
+			stats.Allocations++
+			stats.AllocatedPieces += len(alloc.Pieces)
+			stats.AllocatedSize += alloc.PieceSize
+			if alloc.Confirmed {
+				stats.ConfirmedPieces += len(alloc.Pieces)
+				stats.ConfirmedSize += alloc.PieceSize
+			}
+			if stats.LastAllocation == nil || alloc.Time.After(*stats.LastAllocation) {
+				t := alloc.Time
+				stats.LastAllocation = &t
+			}
+		}
+		if stats.Allocations == 0 && stats.ActivePieces == 0 && stats.LostPieces == 0 {
+			continue
+		}
+		report.DataSets = append(report.DataSets, stats)
+		report.Total.add(stats)
+	}
+
+	limit := CheckQuota(user, sp, nil, repo.Allocations, now)
+	report.QuotaRemaining, report.QuotaReason = limit.Limit, limit.Reason
+	return report
+}
+
+func (s *HolderStats) add(o *HolderStats) {
+	s.Allocations += o.Allocations
+	s.AllocatedPieces += o.AllocatedPieces
+	s.AllocatedSize += o.AllocatedSize
+	s.ConfirmedPieces += o.ConfirmedPieces
+	s.ConfirmedSize += o.ConfirmedSize
+	s.ActivePieces += o.ActivePieces
+	s.ActiveSize += o.ActiveSize
+	s.LostPieces += o.LostPieces
+	s.Repeats += o.Repeats
+	if o.LastAllocation != nil && (s.LastAllocation == nil || o.LastAllocation.After(*s.LastAllocation)) {
+		s.LastAllocation = o.LastAllocation
+	}
+}
+
+var holderColumns = []string{"dataSetName", "allocations", "allocatedPieces", "allocated(TiB)", "confirmedPieces", "confirmed(TiB)", "activePieces", "active(TiB)", "lostPieces", "repeats", "lastAllocation"}
+
+func (s *HolderStats) row() []string {
+	tib := func(size int64) string {
+		return strconv.FormatFloat(float64(size)/(1<<40), 'f', -1, 64)
+	}
+	var last string
+	if s.LastAllocation != nil {
+		last = s.LastAllocation.Format(time.RFC3339)
+	}
+	return []string{s.DataSetName, strconv.Itoa(s.Allocations), strconv.Itoa(s.AllocatedPieces), tib(s.AllocatedSize), strconv.Itoa(s.ConfirmedPieces), tib(s.ConfirmedSize), strconv.Itoa(s.ActivePieces), tib(s.ActiveSize), strconv.Itoa(s.LostPieces), strconv.Itoa(s.Repeats), last}
+}
+
+// Write 以 table、json 或 csv 格式输出，csv 只包含每个数据集和合计
+func (r *HolderReport) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(holderColumns); err != nil {
+			return err
+		}
+		for _, stats := range append(r.DataSets, r.Total) {
+			if err := cw.Write(stats.row()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table":
+	default:
+		return fmt.Errorf("unknown format %s, must be table, json or csv", format)
+	}
+
+	table, err := gotable.Create(holderColumns...)
+	if err != nil {
+		return err
+	}
+	for _, stats := range append(r.DataSets, r.Total) {
+		table.AddRow(stats.row())
+	}
+	fmt.Fprintf(w, "org: %s, sps: %v\n", r.Org, r.Sps)
+	fmt.Fprintln(w, table)
+	if r.QuotaRemaining < 0 {
+		_, err = fmt.Fprintln(w, "quota remaining: unlimited")
+	} else {
+		_, err = fmt.Fprintf(w, "quota remaining: %vTiB (%s)\n", float64(r.QuotaRemaining)/(1<<40), r.QuotaReason)
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestRepo 两个org、两个数据集的仓库，piece都是1TiB
+//
+//	d1(2副本): p1 f1,f9  p2 f1(重复1次),f2(丢失)  p3 f2  p4 无
+//	d2(1副本): q1 f9
+func newTestRepo(now time.Time) *Repo {
+	repo := NewRepo()
+	repo.Users.Add(&User{Org: "o", Quota: &Quota{MaxTiBPerWeek: 5}, Providers: []*Provider{{Sp: "f1"}, {Sp: "f2", Quota: &Quota{MaxTiBPerWeek: 1}}}})
+	repo.Users.Add(&User{Org: "p", Providers: []*Provider{{Sp: "f9"}}})
+
+	d1 := &DataSet{DataSetName: "d1", Duplicate: 2}
+	d1.Add(&Piece{PieceCid: "p1", PieceSize: 1 << 40, SpInfos: []*SpInfo{{Sp: "f1", Num: 1}, {Sp: "f9", Num: 1}}})
+	d1.Add(&Piece{PieceCid: "p2", PieceSize: 1 << 40, SpInfos: []*SpInfo{{Sp: "f1", Num: 2}, {Sp: "f2", Num: 1, Lost: true}}})
+	d1.Add(&Piece{PieceCid: "p3", PieceSize: 1 << 40, SpInfos: []*SpInfo{{Sp: "f2", Num: 1}}})
+	d1.Add(&Piece{PieceCid: "p4", PieceSize: 1 << 40})
+	d2 := &DataSet{DataSetName: "d2", Duplicate: 1}
+	d2.Add(&Piece{PieceCid: "q1", PieceSize: 1 << 40, SpInfos: []*SpInfo{{Sp: "f9", Num: 1}}})
+	repo.DataSets.AddDataSet(d1)
+	repo.DataSets.AddDataSet(d2)
+
+	repo.Allocations.Add(&Allocation{Time: now.Add(-48 * time.Hour), DataSetName: "d1", Org: "o", Sp: "f1", Pieces: []string{"p1", "p2"}, PieceSize: 2 << 40, Confirmed: true})
+	repo.Allocations.Add(&Allocation{Time: now.Add(-time.Hour), DataSetName: "d1", Org: "o", Sp: "f2", Pieces: []string{"p2", "p3"}, PieceSize: 2 << 40})
+	repo.Allocations.Add(&Allocation{Time: now.Add(-time.Hour), DataSetName: "d2", Org: "p", Sp: "f9", Pieces: []string{"q1"}, PieceSize: 1 << 40})
+	return repo
+}
+
+func TestNewHolderReport(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		org      string
+		sp       string
+		dataSets int
+		total    HolderStats
+		quota    int64
+	}{
+		{
+			name:     "org",
+			org:      "o",
+			dataSets: 1,
+			total: HolderStats{DataSetName: "total", Allocations: 2, AllocatedPieces: 4, AllocatedSize: 4 << 40, ConfirmedPieces: 2, ConfirmedSize: 2 << 40,
+				ActivePieces: 3, ActiveSize: 3 << 40, LostPieces: 1, Repeats: 1},
+			// 周配额5TiB，已经分配4TiB
+			quota: 1 << 40,
+		},
+		{
+			name:     "sp",
+			org:      "o",
+			sp:       "f2",
+			dataSets: 1,
+			total:    HolderStats{DataSetName: "total", Allocations: 1, AllocatedPieces: 2, AllocatedSize: 2 << 40, ActivePieces: 1, ActiveSize: 1 << 40, LostPieces: 1},
+			// sp的周配额1TiB已经用完
+			quota: 0,
+		},
+		{
+			// d1 中没有分配记录的副本也统计在内
+			name:     "org without quota",
+			org:      "p",
+			dataSets: 2,
+			total:    HolderStats{DataSetName: "total", Allocations: 1, AllocatedPieces: 1, AllocatedSize: 1 << 40, ActivePieces: 2, ActiveSize: 2 << 40},
+			quota:    -1,
+		},
+	}
+	for _, c := range cases {
+		repo := newTestRepo(now)
+		report := NewHolderReport(repo, repo.Users.Get(c.org), c.sp, now)
+		if len(report.DataSets) != c.dataSets {
+			t.Errorf("%s: got %d datasets, want %d", c.name, len(report.DataSets), c.dataSets)
+		}
+		total := *report.Total
+		if total.Allocations > 0 && total.LastAllocation == nil {
+			t.Errorf("%s: lastAllocation is not set", c.name)
+		}
+		total.LastAllocation = nil
+		if !reflect.DeepEqual(total, c.total) {
+			t.Errorf("%s: got total %+v, want %+v", c.name, total, c.total)
+		}
+		if report.QuotaRemaining != c.quota {
+			t.Errorf("%s: got quota remaining %d, want %d (%s)", c.name, report.QuotaRemaining, c.quota, report.QuotaReason)
+		}
+	}
+}
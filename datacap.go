@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gh-efforts/distribution/distribution"
+)
+
+// Client 数据集使用的 verified client 地址和 DataCap 预算
+type Client = distribution.Client
+
+// DataCapWarning 剩余预算低于 warnBelow(0-1) 时返回提示
+func DataCapWarning(client *Client, warnBelow float64) string {
+	if client == nil || client.DataCap <= 0 {
+		return ""
+	}
+	left := float64(client.Remaining()) / float64(client.DataCap)
+	if left >= warnBelow {
+		return ""
+	}
+	return fmt.Sprintf("client %s has %vTiB (%.1f%%) DataCap left", client.Address, float64(client.Remaining())/(1<<40), left*100)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"sort"
+)
+
+// ReplicaLevel 副本数相同的piece
+type ReplicaLevel struct {
+	Replicas  int   `json:"replicas"`
+	Pieces    int   `json:"pieces"`
+	PieceSize int64 `json:"pieceSize"`
+}
+
+// HolderShare 一个org或sp持有的副本
+type HolderShare struct {
+	Name      string `json:"name"`
+	Replicas  int    `json:"replicas"`
+	PieceSize int64  `json:"pieceSize"`
+	// 占全部副本pieceSize的比例
+	Share float64 `json:"share"`
+}
+
+// DataSetStats 数据集的副本分布和完成进度，丢失的副本不计算在内
+type DataSetStats struct {
+	DataSetName string `json:"dataSetName"`
+	Duplicate   int    `json:"duplicate"`
+	Pieces      int    `json:"pieces"`
+	// 不计副本的pieceSize总和
+	PieceSize int64 `json:"pieceSize"`
+	// 按副本数从0开始
+	Levels []*ReplicaLevel `json:"levels"`
+	// 全部副本的pieceSize总和
+	Distributed int64 `json:"distributed"`
+	// 达到 Duplicate 的进度(0-1)，超过 Duplicate 的副本不计算
+	Complete float64 `json:"complete"`
+	// 达到 Duplicate 还需要的pieceSize
+	Remaining int64          `json:"remaining"`
+	Orgs      []*HolderShare `json:"orgs"`
+	Sps       []*HolderShare `json:"sps"`
+}
+
+// NewDataSetStats 统计数据集的副本分布，users 用于按org汇总，不属于任何org的sp记为 "-"
+func NewDataSetStats(dataSet *DataSet, users *Users) *DataSetStats {
+	stats := &DataSetStats{DataSetName: dataSet.DataSetName, Duplicate: dataSet.Duplicate, Pieces: len(dataSet.Pieces)}
+	orgs := make(map[string]*HolderShare)
+	sps := make(map[string]*HolderShare)
+	hold := func(m map[string]*HolderShare, name string, size int64) {
+		h, ok := m[name]
+		if !ok {
+			h = &HolderShare{Name: name}
+			m[name] = h
+		}
+		h.Replicas++
+		h.PieceSize += size
+	}
+
+	var done int64
+	for _, piece := range dataSet.Pieces {
+		stats.PieceSize += piece.PieceSize
+		replicas := piece.Replicas()
+		for len(stats.Levels) <= replicas {
+			stats.Levels = append(stats.Levels, &ReplicaLevel{Replicas: len(stats.Levels)})
+		}
+		stats.Levels[replicas].Pieces++
+		stats.Levels[replicas].PieceSize += piece.PieceSize
+		stats.Distributed += piece.PieceSize * int64(replicas)
+		if replicas > dataSet.Duplicate {
+			replicas = dataSet.Duplicate
+		}
+		done += piece.PieceSize * int64(replicas)
+
+		for _, spInfo := range piece.SpInfos {
+			if spInfo.Lost {
+				continue
+			}
+			org := "-"
+			if user := users.GetBySp(spInfo.Sp); user != nil {
+				org = user.Org
+			}
+			hold(orgs, org, piece.PieceSize)
+			hold(sps, spInfo.Sp, piece.PieceSize)
+		}
+	}
+
+	target := stats.PieceSize * int64(dataSet.Duplicate)
+	stats.Remaining = target - done
+	if target > 0 {
+		stats.Complete = float64(done) / float64(target)
+	}
+	stats.Orgs = sortShares(orgs, stats.Distributed)
+	stats.Sps = sortShares(sps, stats.Distributed)
+	return stats
+}
+
+// sortShares 计算占比并按pieceSize从大到小排序
+func sortShares(m map[string]*HolderShare, total int64) []*HolderShare {
+	var out []*HolderShare
+	for _, h := range m {
+		if total > 0 {
+			h.Share = float64(h.PieceSize) / float64(total)
+		}
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].PieceSize != out[j].PieceSize {
+			return out[i].PieceSize > out[j].PieceSize
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
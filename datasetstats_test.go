@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewDataSetStats(t *testing.T) {
+	repo := newTestRepo(time.Now())
+	// 1副本的数据集，a 多出2个副本，c 的sp不属于任何org
+	over := &DataSet{DataSetName: "over", Duplicate: 1}
+	over.Add(&Piece{PieceCid: "a", PieceSize: 1 << 40, SpInfos: []*SpInfo{{Sp: "f1", Num: 1}, {Sp: "f2", Num: 1}, {Sp: "f9", Num: 1}}})
+	over.Add(&Piece{PieceCid: "b", PieceSize: 1 << 40})
+	over.Add(&Piece{PieceCid: "c", PieceSize: 1 << 40, SpInfos: []*SpInfo{{Sp: "f77", Num: 1}}})
+
+	cases := []struct {
+		name        string
+		dataSet     *DataSet
+		levels      []int
+		distributed int64
+		complete    float64
+		remaining   int64
+		orgs        []string
+	}{
+		{
+			// 丢失的副本不计算，重复发送的副本只算一个
+			name:        "lost and repeated",
+			dataSet:     repo.DataSets.GetDataset("d1"),
+			levels:      []int{1, 2, 1},
+			distributed: 4 << 40,
+			complete:    0.5,
+			remaining:   4 << 40,
+			orgs:        []string{"o", "p"},
+		},
+		{
+			// 超过 Duplicate 的副本不计入进度
+			name:        "over replicated",
+			dataSet:     over,
+			levels:      []int{1, 1, 0, 1},
+			distributed: 4 << 40,
+			complete:    2.0 / 3,
+			remaining:   1 << 40,
+			orgs:        []string{"o", "-", "p"},
+		},
+		{name: "empty", dataSet: &DataSet{DataSetName: "empty", Duplicate: 2}},
+	}
+	for _, c := range cases {
+		stats := NewDataSetStats(c.dataSet, repo.Users)
+		var levels []int
+		for i, level := range stats.Levels {
+			if level.Replicas != i {
+				t.Errorf("%s: level %d has replicas %d", c.name, i, level.Replicas)
+			}
+			levels = append(levels, level.Pieces)
+		}
+		if !reflect.DeepEqual(levels, c.levels) {
+			t.Errorf("%s: got levels %v, want %v", c.name, levels, c.levels)
+		}
+		if stats.Distributed != c.distributed || stats.Remaining != c.remaining {
+			t.Errorf("%s: got distributed %d remaining %d, want %d %d", c.name, stats.Distributed, stats.Remaining, c.distributed, c.remaining)
+		}
+		if math.Abs(stats.Complete-c.complete) > 1e-9 {
+			t.Errorf("%s: got complete %v, want %v", c.name, stats.Complete, c.complete)
+		}
+		var orgs []string
+		for _, org := range stats.Orgs {
+			orgs = append(orgs, org.Name)
+		}
+		if !reflect.DeepEqual(orgs, c.orgs) {
+			t.Errorf("%s: got orgs %v, want %v", c.name, orgs, c.orgs)
+		}
+	}
+}
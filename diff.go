@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/gh-efforts/distribution/distribution"
+	"github.com/liushuochen/gotable"
+)
+
+const (
+	actionAdd    = "add"
+	actionDelete = "delete"
+	actionUpdate = "update"
+)
+
+// RepoDiff 两个仓库状态之间的差异
+type RepoDiff struct {
+	Orgs     []*OrgChange     `json:"orgs"`
+	DataSets []*DataSetChange `json:"dataSets"`
+	Pieces   []*PieceChange   `json:"pieces"`
+	SpInfos  []*SpInfoChange  `json:"spInfos"`
+
+	Allocations []*AllocationChange `json:"allocations"`
+	Mirrors     []*MirrorChange     `json:"mirrors"`
+}
+
+type OrgChange struct {
+	Org    string   `json:"org"`
+	Action string   `json:"action"`
+	Before []string `json:"before"`
+	After  []string `json:"after"`
+}
+
+// DataSetChange 数据集的增删，或者除pieces外某个字段的修改，Before/After 为字段的json值
+type DataSetChange struct {
+	DataSetName string `json:"dataSetName"`
+	Action      string `json:"action"`
+	Field       string `json:"field,omitempty"`
+	Before      string `json:"before,omitempty"`
+	After       string `json:"after,omitempty"`
+}
+
+type PieceChange struct {
+	DataSetName string `json:"dataSetName"`
+	PieceCid    string `json:"pieceCid"`
+	Action      string `json:"action"`
+	PieceSize   int64  `json:"pieceSize"`
+	CarSize     int64  `json:"carSize"`
+	// 优先级、标签等其他字段的修改
+	Field  string `json:"field,omitempty"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// SpInfoChange 某个piece上某个sp的发送次数变化，Before为0表示新增，After为0表示删除
+type SpInfoChange struct {
+	DataSetName string `json:"dataSetName"`
+	PieceCid    string `json:"pieceCid"`
+	Sp          string `json:"sp"`
+	Before      int    `json:"before"`
+	After       int    `json:"after"`
+}
+
+type AllocationChange struct {
+	ID          int64  `json:"id"`
+	Action      string `json:"action"`
+	DataSetName string `json:"dataSetName"`
+	Sp          string `json:"sp"`
+	PieceSize   int64  `json:"pieceSize"`
+	Confirmed   bool   `json:"confirmed"`
+}
+
+type MirrorChange struct {
+	Name   string  `json:"name"`
+	Action string  `json:"action"`
+	Before *Mirror `json:"before"`
+	After  *Mirror `json:"after"`
+}
+
+// DiffRepo 计算从 before 到 after 的差异
+func DiffRepo(before, after *Repo) *RepoDiff {
+	diff := new(RepoDiff)
+	diff.diffUsers(before.Users, after.Users)
+	diff.diffDataSets(before.DataSets, after.DataSets)
+	diff.diffAllocations(before.Allocations, after.Allocations)
+	diff.diffMirrors(before.Mirrors, after.Mirrors)
+	return diff
+}
+
+func (rd *RepoDiff) Empty() bool {
+	return len(rd.Orgs) == 0 && len(rd.DataSets) == 0 && len(rd.Pieces) == 0 && len(rd.SpInfos) == 0 && len(rd.Allocations) == 0 && len(rd.Mirrors) == 0
+}
+
+// Summary 返回每类修改的数量
+func (rd *RepoDiff) Summary() string {
+	return fmt.Sprintf("orgs: %d, dataSets: %d, pieces: %d, spInfos: %d, allocations: %d, mirrors: %d", len(rd.Orgs), len(rd.DataSets), len(rd.Pieces), len(rd.SpInfos), len(rd.Allocations), len(rd.Mirrors))
+}
+
+func (rd *RepoDiff) diffUsers(before, after *Users) {
+	for _, old := range before.List {
+		user := after.Get(old.Org)
+		if user == nil {
+			rd.Orgs = append(rd.Orgs, &OrgChange{Org: old.Org, Action: actionDelete, Before: old.Sps()})
+		} else if !jsonEqual(old, user) {
+			rd.Orgs = append(rd.Orgs, &OrgChange{Org: old.Org, Action: actionUpdate, Before: old.Sps(), After: user.Sps()})
+		}
+	}
+	for _, user := range after.List {
+		if before.Get(user.Org) == nil {
+			rd.Orgs = append(rd.Orgs, &OrgChange{Org: user.Org, Action: actionAdd, After: user.Sps()})
+		}
+	}
+}
+
+func (rd *RepoDiff) diffDataSets(before, after *DataSets) {
+	empty := distribution.NewDataSet()
+	for _, old := range before.List {
+		dataSet := after.GetDataset(old.DataSetName)
+		if dataSet == nil {
+			rd.DataSets = append(rd.DataSets, &DataSetChange{DataSetName: old.DataSetName, Action: actionDelete})
+			rd.diffPieces(old.DataSetName, old, empty)
+			continue
+		}
+		rd.diffDataSetFields(old, dataSet)
+		rd.diffPieces(old.DataSetName, old, dataSet)
+	}
+	for _, dataSet := range after.List {
+		if before.GetDataset(dataSet.DataSetName) == nil {
+			rd.DataSets = append(rd.DataSets, &DataSetChange{DataSetName: dataSet.DataSetName, Action: actionAdd})
+			rd.diffPieces(dataSet.DataSetName, empty, dataSet)
+		}
+	}
+}
+
+// diffDataSetFields 比较数据集除pieces以外的字段
+func (rd *RepoDiff) diffDataSetFields(before, after *DataSet) {
+	for _, f := range diffFields(before, after, "pieces") {
+		rd.DataSets = append(rd.DataSets, &DataSetChange{DataSetName: after.DataSetName, Action: actionUpdate, Field: f.name, Before: f.before, After: f.after})
+	}
+}
+
+type fieldChange struct {
+	name, before, after string
+}
+
+// diffFields 按json字段比较 before 和 after，跳过 skip 中的字段
+func diffFields(before, after interface{}, skip ...string) []*fieldChange {
+	oldFields, newFields := jsonFields(before), jsonFields(after)
+	for _, name := range skip {
+		delete(oldFields, name)
+		delete(newFields, name)
+	}
+	var names []string
+	for name := range oldFields {
+		names = append(names, name)
+	}
+	for name := range newFields {
+		if _, ok := oldFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var out []*fieldChange
+	for _, name := range names {
+		if string(oldFields[name]) != string(newFields[name]) {
+			out = append(out, &fieldChange{name: name, before: string(oldFields[name]), after: string(newFields[name])})
+		}
+	}
+	return out
+}
+
+func jsonFields(v interface{}) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+func (rd *RepoDiff) diffPieces(dataSetName string, before, after *DataSet) {
+	empty := new(Piece)
+	for _, old := range before.Pieces {
+		piece := after.Get(old.PieceCid)
+		if piece == nil {
+			rd.Pieces = append(rd.Pieces, &PieceChange{DataSetName: dataSetName, PieceCid: old.PieceCid, Action: actionDelete, PieceSize: old.PieceSize, CarSize: old.CarSize})
+			rd.diffSpInfos(dataSetName, old.PieceCid, old, empty)
+			continue
+		}
+		if old.PieceSize != piece.PieceSize || old.CarSize != piece.CarSize {
+			rd.Pieces = append(rd.Pieces, &PieceChange{DataSetName: dataSetName, PieceCid: old.PieceCid, Action: actionUpdate, PieceSize: piece.PieceSize, CarSize: piece.CarSize})
+		}
+		for _, f := range diffFields(old, piece, "pieceSize", "carSize", "spInfos") {
+			rd.Pieces = append(rd.Pieces, &PieceChange{DataSetName: dataSetName, PieceCid: old.PieceCid, Action: actionUpdate, PieceSize: piece.PieceSize, CarSize: piece.CarSize, Field: f.name, Before: f.before, After: f.after})
+		}
+		rd.diffSpInfos(dataSetName, old.PieceCid, old, piece)
+	}
+	for _, piece := range after.Pieces {
+		if before.Get(piece.PieceCid) == nil {
+			rd.Pieces = append(rd.Pieces, &PieceChange{DataSetName: dataSetName, PieceCid: piece.PieceCid, Action: actionAdd, PieceSize: piece.PieceSize, CarSize: piece.CarSize})
+			rd.diffSpInfos(dataSetName, piece.PieceCid, empty, piece)
+		}
+	}
+}
+
+func (rd *RepoDiff) diffSpInfos(dataSetName, pieceCid string, before, after *Piece) {
+	oldNums, newNums := spNums(before), spNums(after)
+	seen := make(map[string]bool)
+	for _, spInfo := range append(append([]*SpInfo{}, before.SpInfos...), after.SpInfos...) {
+		sp := spInfo.Sp
+		if seen[sp] {
+			continue
+		}
+		seen[sp] = true
+		if oldNums[sp] != newNums[sp] {
+			rd.SpInfos = append(rd.SpInfos, &SpInfoChange{DataSetName: dataSetName, PieceCid: pieceCid, Sp: sp, Before: oldNums[sp], After: newNums[sp]})
+		}
+	}
+}
+
+func (rd *RepoDiff) diffAllocations(before, after *Allocations) {
+	for _, old := range before.List {
+		alloc := after.Get(old.ID)
+		if alloc == nil {
+			rd.Allocations = append(rd.Allocations, &AllocationChange{ID: old.ID, Action: actionDelete, DataSetName: old.DataSetName, Sp: old.Sp, PieceSize: old.PieceSize, Confirmed: old.Confirmed})
+		} else if !jsonEqual(old, alloc) {
+			rd.Allocations = append(rd.Allocations, &AllocationChange{ID: alloc.ID, Action: actionUpdate, DataSetName: alloc.DataSetName, Sp: alloc.Sp, PieceSize: alloc.PieceSize, Confirmed: alloc.Confirmed})
+		}
+	}
+	for _, alloc := range after.List {
+		if before.Get(alloc.ID) == nil {
+			rd.Allocations = append(rd.Allocations, &AllocationChange{ID: alloc.ID, Action: actionAdd, DataSetName: alloc.DataSetName, Sp: alloc.Sp, PieceSize: alloc.PieceSize, Confirmed: alloc.Confirmed})
+		}
+	}
+}
+
+func (rd *RepoDiff) diffMirrors(before, after *Mirrors) {
+	for _, old := range before.List {
+		mirror := after.Get(old.Name)
+		if mirror == nil {
+			rd.Mirrors = append(rd.Mirrors, &MirrorChange{Name: old.Name, Action: actionDelete, Before: old})
+		} else if !jsonEqual(old, mirror) {
+			rd.Mirrors = append(rd.Mirrors, &MirrorChange{Name: old.Name, Action: actionUpdate, Before: old, After: mirror})
+		}
+	}
+	for _, mirror := range after.List {
+		if before.Get(mirror.Name) == nil {
+			rd.Mirrors = append(rd.Mirrors, &MirrorChange{Name: mirror.Name, Action: actionAdd, After: mirror})
+		}
+	}
+}
+
+// spNums 统计piece上每个sp的发送次数，丢失的副本记为0
+func spNums(piece *Piece) map[string]int {
+	nums := make(map[string]int)
+	for _, spInfo := range piece.SpInfos {
+		if spInfo.Lost {
+			continue
+		}
+		nums[spInfo.Sp] += spInfo.Num
+	}
+	return nums
+}
+
+// Print 以表格或json形式输出差异
+func (rd *RepoDiff) Print(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(rd, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "", "table":
+	default:
+		return fmt.Errorf("unknown diff format %s, must be table or json", format)
+	}
+
+	if rd.Empty() {
+		_, err := fmt.Fprintln(w, "no changes")
+		return err
+	}
+
+	table, err := gotable.Create("kind", "action", "dataSet", "target", "before", "after")
+	if err != nil {
+		return err
+	}
+	for _, c := range rd.Orgs {
+		before, _ := json.Marshal(c.Before)
+		after, _ := json.Marshal(c.After)
+		table.AddRow([]string{"org", c.Action, "", c.Org, string(before), string(after)})
+	}
+	for _, c := range rd.DataSets {
+		table.AddRow([]string{"dataSet", c.Action, c.DataSetName, c.Field, c.Before, c.After})
+	}
+	for _, c := range rd.Pieces {
+		if c.Field != "" {
+			table.AddRow([]string{"piece", c.Action, c.DataSetName, c.PieceCid + " " + c.Field, c.Before, c.After})
+			continue
+		}
+		table.AddRow([]string{"piece", c.Action, c.DataSetName, c.PieceCid, "", strconv.FormatInt(c.PieceSize, 10)})
+	}
+	for _, c := range rd.SpInfos {
+		action := actionUpdate
+		if c.Before == 0 {
+			action = actionAdd
+		} else if c.After == 0 {
+			action = actionDelete
+		}
+		table.AddRow([]string{"spInfo", action, c.DataSetName, c.Sp + " " + c.PieceCid, strconv.Itoa(c.Before), strconv.Itoa(c.After)})
+	}
+	for _, c := range rd.Mirrors {
+		before, after := "", ""
+		if c.Before != nil {
+			data, _ := json.Marshal(c.Before)
+			before = string(data)
+		}
+		if c.After != nil {
+			data, _ := json.Marshal(c.After)
+			after = string(data)
+		}
+		table.AddRow([]string{"mirror", c.Action, "", c.Name, before, after})
+	}
+	for _, c := range rd.Allocations {
+		table.AddRow([]string{"allocation", c.Action, c.DataSetName, fmt.Sprintf("%d %s", c.ID, c.Sp), "", fmt.Sprintf("%vTiB confirmed=%v", float64(c.PieceSize)/(1<<40), c.Confirmed)})
+	}
+	_, err = fmt.Fprintln(w, table)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, rd.Summary())
+	return err
+}
@@ -4,21 +4,66 @@ import (
 	"encoding/json"
 	"errors"
 	"os"
+
+	"github.com/gh-efforts/distribution/distribution"
 )
 
 var (
 	orgsJson     string
 	dataSetsJson string
+)
 
-	// 副本数量，默认10
-	duplicate int
-	// 单个SP单个piece重复的次数，正常最大为0
-	repeat int
+// 数据集相关的类型定义在 distribution 包中
+type (
+	SpInfo  = distribution.SpInfo
+	Piece   = distribution.Piece
+	DataSet = distribution.DataSet
 )
 
+// User 一个组织，Providers 是组织内的全部sp及其属性
 type User struct {
-	Org string   `json:"org"`
-	Sps []string `json:"sps"`
+	Org       string      `json:"org"`
+	Quota     *Quota      `json:"quota,omitempty"`
+	Providers []*Provider `json:"providers"`
+}
+
+// UnmarshalJSON 兼容旧文件中的 sps 列表：按 sps 的顺序生成 Providers，保留已有的属性，丢弃不在列表中的属性
+func (u *User) UnmarshalJSON(data []byte) error {
+	type user User
+	var v struct {
+		user
+		Sps []string `json:"sps"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*u = User(v.user)
+	if v.Sps != nil {
+		u.SetSps(v.Sps)
+	}
+	return nil
+}
+
+// Sps 返回组织内全部sp
+func (u *User) Sps() []string {
+	sps := make([]string, 0, len(u.Providers))
+	for _, p := range u.Providers {
+		sps = append(sps, p.Sp)
+	}
+	return sps
+}
+
+// SetSps 把组织的sp替换为 sps，仍在列表中的sp保留属性、状态和配额
+func (u *User) SetSps(sps []string) {
+	providers := make([]*Provider, 0, len(sps))
+	for _, sp := range sps {
+		p := u.Provider(sp)
+		if p == nil {
+			p = &Provider{Sp: sp}
+		}
+		providers = append(providers, p)
+	}
+	u.Providers = providers
 }
 
 type Users struct {
@@ -83,18 +128,24 @@ func (u *Users) Get(org string) *User {
 	return nil
 }
 
-// GetSps 用已知的sp获取到所在org的全部sp
-func (u *Users) GetSps(inputSp string) []string {
+// GetBySp 用已知的sp获取到所在的org
+func (u *Users) GetBySp(inputSp string) *User {
 	for _, user := range u.List {
-		for _, sp := range user.Sps {
-			if sp == inputSp {
-				return user.Sps
-			}
+		if user.Provider(inputSp) != nil {
+			return user
 		}
 	}
 	return nil
 }
 
+// GetSps 用已知的sp获取到所在org的全部sp
+func (u *Users) GetSps(inputSp string) []string {
+	if user := u.GetBySp(inputSp); user != nil {
+		return user.Sps()
+	}
+	return nil
+}
+
 func (u *Users) Update(update *User) {
 	for i, user := range u.List {
 		if user.Org == update.Org {
@@ -124,29 +175,10 @@ func (u *Users) View() (string, error) {
 	return string(data), nil
 }
 
-type SpInfo struct {
-	Sp  string `json:"sp"`
-	Num int    `json:"num"`
-}
-
-type Piece struct {
-	PieceCid  string    `json:"pieceCid"`
-	PieceSize int64     `json:"pieceSize"`
-	CarSize   int64     `json:"carSize"`
-	SpInfos   []*SpInfo `json:"spInfos"`
-}
-type DataSet struct {
-	Duplicate   int      `json:"duplicate"`
-	DataSetName string   `json:"dataSetName"`
-	Pieces      []*Piece `json:"pieces"`
-}
 type DataSets struct {
 	List []*DataSet `json:"list"`
 }
 
-func NewDataSet() *DataSet {
-	return new(DataSet)
-}
 func NewDataSets() *DataSets {
 	return new(DataSets)
 }
@@ -231,87 +263,3 @@ func (d *DataSets) View() (string, error) {
 	}
 	return string(data), nil
 }
-
-func (d *DataSet) Add(piece *Piece) {
-	d.Pieces = append(d.Pieces, piece)
-}
-
-func (d *DataSet) Get(pieceCid string) *Piece {
-	for _, piece := range d.Pieces {
-		if piece.PieceCid == pieceCid {
-			return piece
-		}
-	}
-	return nil
-}
-
-// GetSize 返回符合条件的Pieces,总的pieceSize,总的carSize.会判断副本的数量，组织内其他sp是否已经发送，已经发送的次数是否小于等于repeat
-func (d *DataSet) GetSize(inputSp string, size int64, sps []string) (*DataSet, int64, int64) {
-	outPieces := NewDataSet()
-	pieceSize := int64(0)
-	carSize := int64(0)
-
-	if duplicate == 0 {
-		duplicate = d.Duplicate
-	}
-
-	for _, piece := range d.Pieces {
-		if pieceSize >= size {
-			continue
-		}
-		if len(piece.SpInfos) >= duplicate {
-			continue
-		}
-		var haveSP bool
-		for _, spInfo := range piece.SpInfos {
-			if spInfo.Sp == inputSp {
-				haveSP = true
-				if spInfo.Num <= repeat {
-					spInfo.Num += 1
-					pieceSize += piece.PieceSize
-					carSize += piece.CarSize
-					outPieces.Add(piece)
-
-				}
-				break
-			} else {
-				for _, sp := range sps {
-					if spInfo.Sp == sp && spInfo.Num > repeat {
-						haveSP = true
-						break
-					}
-				}
-			}
-		}
-
-		if !haveSP {
-			pieceSize += piece.PieceSize
-			carSize += piece.CarSize
-			outPieces.Add(piece)
-			piece.SpInfos = append(piece.SpInfos, &SpInfo{inputSp, 1})
-		}
-
-	}
-	return outPieces, pieceSize, carSize
-}
-
-func (d *DataSet) Update(update *Piece) {
-	for i, piece := range d.Pieces {
-		if piece.PieceCid == update.PieceCid {
-			d.Pieces[i] = update
-			break
-
-		}
-	}
-}
-
-func (d *DataSet) Delete(pieceCid string) bool {
-	for i, piece := range d.Pieces {
-		if piece.PieceCid == pieceCid {
-			d.Pieces = append(d.Pieces[:i], d.Pieces[i+1:]...)
-			return true
-
-		}
-	}
-	return false
-}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUserUnmarshalLegacySps(t *testing.T) {
+	cases := []struct {
+		name    string
+		data    string
+		sps     []string
+		regions []string
+	}{
+		{
+			name:    "providers only",
+			data:    `{"org":"o","providers":[{"sp":"f1","region":"asia"},{"sp":"f2"}]}`,
+			sps:     []string{"f1", "f2"},
+			regions: []string{"asia", ""},
+		},
+		{
+			// 旧文件按 sps 的顺序生成 Providers，保留已有的属性
+			name:    "legacy sps",
+			data:    `{"org":"o","sps":["f1","f2","f3"],"providers":[{"sp":"f2","region":"eu"}]}`,
+			sps:     []string{"f1", "f2", "f3"},
+			regions: []string{"", "eu", ""},
+		},
+		{
+			// 不在 sps 中的属性是旧版本移除sp时留下的，丢弃
+			name:    "legacy orphan provider",
+			data:    `{"org":"o","sps":["f1"],"providers":[{"sp":"f9","region":"eu"}]}`,
+			sps:     []string{"f1"},
+			regions: []string{""},
+		},
+		{name: "legacy empty", data: `{"org":"o","sps":[]}`, sps: []string{}},
+	}
+	for _, c := range cases {
+		user := new(User)
+		if err := json.Unmarshal([]byte(c.data), user); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !reflect.DeepEqual(user.Sps(), c.sps) {
+			t.Errorf("%s: got sps %v, want %v", c.name, user.Sps(), c.sps)
+			continue
+		}
+		for i, p := range user.Providers {
+			if p.Region != c.regions[i] {
+				t.Errorf("%s: %s got region %q, want %q", c.name, p.Sp, p.Region, c.regions[i])
+			}
+		}
+	}
+}
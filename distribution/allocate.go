@@ -0,0 +1,147 @@
+package distribution
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Fit 决定加上下一个piece会超过 Size 时是否仍然分配
+type Fit string
+
+const (
+	// FitOver 分配到总pieceSize不小于 Size 为止，最后一个piece可以超过 Size
+	FitOver Fit = "over"
+	// FitUnder 总pieceSize不超过 Size，跳过放不下的piece
+	FitUnder Fit = "under"
+)
+
+// AllocateRequest 一次分配的参数
+type AllocateRequest struct {
+	Sp string
+	// sp 所在组织的全部sp，组织内其他sp已经发送过的piece不会再分配
+	OrgSps []string
+	// 需要的pieceSize(bytes)
+	Size int64
+	// 副本数量，0表示使用数据集的副本数
+	Duplicate int
+	// 单个SP单个piece重复的次数，正常为0
+	Repeat int
+	// 按组织分配时为 true，组织内其他sp持有的piece不再分配，不受 Repeat 影响
+	ExcludeOrgMates bool
+	// 为空时使用 FitOver
+	Fit Fit
+	// 配额等允许的最大pieceSize(bytes)，0表示不限制
+	Limit int64
+	// 为空时使用 FirstFit
+	Strategy AllocationStrategy
+	// 只分配有其中任意一个标签的piece，为空表示不限制
+	Tags []string
+}
+
+// AllocateResult 一次分配的结果
+type AllocateResult struct {
+	Pieces    []*Piece
+	PieceSize int64
+	CarSize   int64
+}
+
+// Allocate 按piece的优先级从高到低、同一优先级内按 req.Strategy 的顺序选择符合条件的piece分配给 req.Sp，并记录到piece的 SpInfos 中。
+// 会判断副本的数量，组织内其他sp是否已经发送，已经发送的次数是否小于等于 Repeat，丢失的副本不计算在内
+func Allocate(d *DataSet, req *AllocateRequest) (*AllocateResult, error) {
+	fit := req.Fit
+	if fit == "" {
+		fit = FitOver
+	}
+	if fit != FitOver && fit != FitUnder {
+		return nil, fmt.Errorf("unknown fit %s, must be %s or %s", fit, FitOver, FitUnder)
+	}
+	if status := d.GetStatus(); status != DataSetOpen {
+		return nil, fmt.Errorf("dataset %s is %s", d.DataSetName, status)
+	}
+	if req.Size < 0 || req.Limit < 0 {
+		return nil, fmt.Errorf("size and limit must not be negative")
+	}
+	duplicate := req.Duplicate
+	if duplicate == 0 {
+		duplicate = d.Duplicate
+	}
+
+	strategy := req.Strategy
+	if strategy == nil {
+		strategy = FirstFit{}
+	}
+
+	order := strategy.Order(d, req)
+	sort.SliceStable(order, func(i, j int) bool {
+		return d.Pieces[order[i]].Priority > d.Pieces[order[j]].Priority
+	})
+
+	result := new(AllocateResult)
+	var allocated []int
+	for _, i := range order {
+		piece := d.Pieces[i]
+		if result.PieceSize >= req.Size {
+			break
+		}
+		if piece.Replicas() >= duplicate {
+			continue
+		}
+		if len(req.Tags) > 0 && !piece.HasAnyTag(req.Tags) {
+			continue
+		}
+		if req.Limit > 0 && result.PieceSize+piece.PieceSize > req.Limit {
+			continue
+		}
+		if fit == FitUnder && result.PieceSize+piece.PieceSize > req.Size {
+			continue
+		}
+
+		// 组织内其他sp已经发送的次数超过 Repeat 时跳过，ExcludeOrgMates 时只要发送过就跳过，丢失的副本不计算在内
+		var own *SpInfo
+		blocked := false
+		for _, spInfo := range piece.SpInfos {
+			if spInfo.Sp == req.Sp {
+				own = spInfo
+				continue
+			}
+			if !spInfo.Lost && (spInfo.Num > req.Repeat || req.ExcludeOrgMates) && containsSp(req.OrgSps, spInfo.Sp) {
+				blocked = true
+			}
+		}
+		if blocked {
+			continue
+		}
+		switch {
+		case own == nil:
+			piece.SpInfos = append(piece.SpInfos, &SpInfo{Sp: req.Sp, Num: 1})
+		case own.Lost:
+			// 丢失的副本重新分配给原来的sp时恢复记录
+			own.Lost, own.Num = false, 1
+		case own.Num <= req.Repeat:
+			own.Num++
+		default:
+			continue
+		}
+		result.add(piece)
+		allocated = append(allocated, i)
+	}
+	if recorder, ok := strategy.(Recorder); ok {
+		recorder.Record(d, allocated)
+	}
+	return result, nil
+}
+
+func containsSp(sps []string, sp string) bool {
+	for _, s := range sps {
+		if s == sp {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *AllocateResult) add(piece *Piece) {
+	r.Pieces = append(r.Pieces, piece)
+	r.PieceSize += piece.PieceSize
+	r.CarSize += piece.CarSize
+}
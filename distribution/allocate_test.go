@@ -0,0 +1,150 @@
+package distribution
+
+import (
+	"fmt"
+	"testing"
+)
+
+// newTestDataSet 生成 n 个 32GiB 的piece
+func newTestDataSet(n, duplicate int) *DataSet {
+	d := &DataSet{DataSetName: "test", Duplicate: duplicate}
+	for i := 0; i < n; i++ {
+		d.Add(&Piece{PieceCid: fmt.Sprintf("baga%d", i), PieceSize: 32 << 30, CarSize: 30 << 30})
+	}
+	return d
+}
+
+func TestAllocateDefaultDuplicate(t *testing.T) {
+	d := newTestDataSet(4, 2)
+	for i, sp := range []string{"f01", "f02", "f03"} {
+		result, err := Allocate(d, &AllocateRequest{Sp: sp, OrgSps: []string{sp}, Size: 1 << 40})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Duplicate 为0时使用数据集的2个副本，第三个sp分配不到piece
+		want := 4
+		if i == 2 {
+			want = 0
+		}
+		if len(result.Pieces) != want {
+			t.Fatalf("%s: got %d pieces, want %d", sp, len(result.Pieces), want)
+		}
+	}
+	for _, piece := range d.Pieces {
+		if piece.Replicas() != 2 {
+			t.Fatalf("%s has %d replicas, want 2", piece.PieceCid, piece.Replicas())
+		}
+	}
+
+	// 指定 Duplicate 时覆盖数据集的副本数
+	result, err := Allocate(d, &AllocateRequest{Sp: "f03", OrgSps: []string{"f03"}, Size: 1 << 40, Duplicate: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pieces) != 4 {
+		t.Fatalf("got %d pieces with Duplicate 3, want 4", len(result.Pieces))
+	}
+}
+
+func TestAllocateDefaults(t *testing.T) {
+	d := newTestDataSet(4, 1)
+	// Fit 为空时使用 FitOver，最后一个piece可以超过 Size
+	result, err := Allocate(d, &AllocateRequest{Sp: "f01", Size: 40 << 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pieces) != 2 || result.PieceSize != 64<<30 || result.CarSize != 60<<30 {
+		t.Fatalf("got %d pieces, pieceSize %d, carSize %d", len(result.Pieces), result.PieceSize, result.CarSize)
+	}
+	// Strategy 为空时使用 FirstFit，按文件顺序分配
+	if result.Pieces[0].PieceCid != "baga0" || result.Pieces[1].PieceCid != "baga1" {
+		t.Fatalf("got %s, %s, want baga0, baga1", result.Pieces[0].PieceCid, result.Pieces[1].PieceCid)
+	}
+}
+
+func TestAllocateInvalidRequest(t *testing.T) {
+	cases := []struct {
+		name string
+		req  *AllocateRequest
+	}{
+		{name: "negative size", req: &AllocateRequest{Sp: "f01", Size: -1}},
+		{name: "negative limit", req: &AllocateRequest{Sp: "f01", Size: 1 << 40, Limit: -1}},
+		{name: "unknown fit", req: &AllocateRequest{Sp: "f01", Size: 1 << 40, Fit: "exact"}},
+	}
+	for _, c := range cases {
+		d := newTestDataSet(4, 2)
+		if _, err := Allocate(d, c.req); err == nil {
+			t.Errorf("%s: expected an error", c.name)
+		}
+		for _, piece := range d.Pieces {
+			if len(piece.SpInfos) != 0 {
+				t.Fatalf("%s: the dataset was modified", c.name)
+			}
+		}
+	}
+
+	d := newTestDataSet(4, 2)
+	d.Status = DataSetPaused
+	if _, err := Allocate(d, &AllocateRequest{Sp: "f01", Size: 1 << 40}); err == nil {
+		t.Error("expected an error for a paused dataset")
+	}
+}
+
+func TestAllocateRestoreLost(t *testing.T) {
+	d := newTestDataSet(2, 3)
+	// baga0 丢失后已经由同组织的 f02 重新发送，不能再恢复 f01 的记录
+	d.Pieces[0].SpInfos = []*SpInfo{{Sp: "f01", Num: 1, Lost: true}, {Sp: "f02", Num: 1}}
+	d.Pieces[1].SpInfos = []*SpInfo{{Sp: "f01", Num: 1, Lost: true}}
+
+	result, err := Allocate(d, &AllocateRequest{Sp: "f01", OrgSps: []string{"f01", "f02"}, Size: 1 << 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pieces) != 1 || result.Pieces[0].PieceCid != "baga1" {
+		t.Fatalf("got %d pieces, want only baga1", len(result.Pieces))
+	}
+	if !d.Pieces[0].SpInfos[0].Lost {
+		t.Fatal("the lost replica of baga0 was restored although f02 of the same org holds it")
+	}
+	if infos := d.Pieces[1].SpInfos; len(infos) != 1 || infos[0].Lost || infos[0].Num != 1 {
+		t.Fatalf("the lost replica of baga1 was not restored: %+v", *infos[0])
+	}
+}
+
+func TestAllocateExcludeOrgMates(t *testing.T) {
+	cases := []struct {
+		name    string
+		exclude bool
+		want    int
+	}{
+		// Repeat 为1时同一组织的 f02 可以再分到 f01 已经持有的piece
+		{name: "repeat only", exclude: false, want: 2},
+		// 按组织分配时不受 Repeat 影响
+		{name: "exclude org mates", exclude: true, want: 0},
+	}
+	for _, c := range cases {
+		d := newTestDataSet(2, 3)
+		org := []string{"f01", "f02"}
+		if _, err := Allocate(d, &AllocateRequest{Sp: "f01", OrgSps: org, Size: 1 << 40, Repeat: 1, ExcludeOrgMates: c.exclude}); err != nil {
+			t.Fatal(err)
+		}
+		result, err := Allocate(d, &AllocateRequest{Sp: "f02", OrgSps: org, Size: 1 << 40, Repeat: 1, ExcludeOrgMates: c.exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Pieces) != c.want {
+			t.Errorf("%s: f02 got %d pieces, want %d", c.name, len(result.Pieces), c.want)
+		}
+	}
+
+	// 丢失的副本不算组织内已经持有
+	d := newTestDataSet(1, 3)
+	d.Pieces[0].SpInfos = []*SpInfo{{Sp: "f01", Num: 1, Lost: true}}
+	result, err := Allocate(d, &AllocateRequest{Sp: "f02", OrgSps: []string{"f01", "f02"}, Size: 1 << 40, Repeat: 1, ExcludeOrgMates: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Pieces) != 1 {
+		t.Fatalf("got %d pieces, want the piece lost by f01", len(result.Pieces))
+	}
+}
@@ -0,0 +1,181 @@
+// Package distribution 数据集分配的核心逻辑，不依赖命令行和仓库文件，可以直接嵌入其他Go服务
+package distribution
+
+import "fmt"
+
+type SpInfo struct {
+	Sp  string `json:"sp"`
+	Num int    `json:"num"`
+	// 副本已经丢失(例如sp退出)，不计入副本数，保留记录用于追溯
+	Lost bool `json:"lost,omitempty"`
+}
+
+type Piece struct {
+	PieceCid  string `json:"pieceCid"`
+	PieceSize int64  `json:"pieceSize"`
+	CarSize   int64  `json:"carSize"`
+	DataCid   string `json:"dataCid,omitempty"`
+	// car文件的sha256，用于下载工具校验
+	Sha256 string `json:"sha256,omitempty"`
+	// 指定该piece使用的下载源，为空时使用数据集的下载源
+	Mirrors []string `json:"mirrors,omitempty"`
+	// 优先级高的piece先分配
+	Priority int       `json:"priority,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	SpInfos  []*SpInfo `json:"spInfos"`
+}
+
+// Replicas 返回没有丢失的副本数
+func (p *Piece) Replicas() int {
+	n := 0
+	for _, spInfo := range p.SpInfos {
+		if !spInfo.Lost {
+			n++
+		}
+	}
+	return n
+}
+
+// HasAnyTag piece 是否有 tags 中的任意一个标签
+func (p *Piece) HasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		for _, t := range p.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type DataSet struct {
+	Duplicate   int       `json:"duplicate"`
+	DataSetName string    `json:"dataSetName"`
+	Pieces      []*Piece  `json:"pieces"`
+	Clients     []*Client `json:"clients,omitempty"`
+	Mirrors     []string  `json:"mirrors,omitempty"`
+	// 链接模板，为空时使用 prefix + pieceCid + suffix
+	LinkTemplate string `json:"linkTemplate,omitempty"`
+	// 分配策略，为空时使用 first-fit
+	Strategy string `json:"strategy,omitempty"`
+	// round-robin 策略下次开始的piece下标
+	Cursor int `json:"cursor,omitempty"`
+
+	ClientName string `json:"clientName,omitempty"`
+	// LDN 申请的 issue 编号或链接
+	LDN         string `json:"ldn,omitempty"`
+	DataOwner   string `json:"dataOwner,omitempty"`
+	Description string `json:"description,omitempty"`
+	// 为空表示 open
+	Status string `json:"status,omitempty"`
+}
+
+// 数据集状态，只有 open 的数据集可以分配
+const (
+	DataSetOpen   = "open"
+	DataSetPaused = "paused"
+	DataSetClosed = "closed"
+)
+
+// ValidDataSetStatus status 是否为合法的数据集状态
+func ValidDataSetStatus(status string) bool {
+	return status == DataSetOpen || status == DataSetPaused || status == DataSetClosed
+}
+
+// GetStatus 返回数据集状态，没有设置时为 open
+func (d *DataSet) GetStatus() string {
+	if d.Status == "" {
+		return DataSetOpen
+	}
+	return d.Status
+}
+
+func NewDataSet() *DataSet {
+	return new(DataSet)
+}
+
+func (d *DataSet) Add(piece *Piece) {
+	d.Pieces = append(d.Pieces, piece)
+}
+
+func (d *DataSet) Get(pieceCid string) *Piece {
+	for _, piece := range d.Pieces {
+		if piece.PieceCid == pieceCid {
+			return piece
+		}
+	}
+	return nil
+}
+
+func (d *DataSet) Update(update *Piece) {
+	for i, piece := range d.Pieces {
+		if piece.PieceCid == update.PieceCid {
+			d.Pieces[i] = update
+			break
+
+		}
+	}
+}
+
+func (d *DataSet) Delete(pieceCid string) bool {
+	for i, piece := range d.Pieces {
+		if piece.PieceCid == pieceCid {
+			d.Pieces = append(d.Pieces[:i], d.Pieces[i+1:]...)
+			return true
+
+		}
+	}
+	return false
+}
+
+// Client 数据集使用的 verified client 地址和 DataCap 预算
+type Client struct {
+	Address string `json:"address"`
+	// 分配给数据集的 DataCap 预算(bytes)
+	DataCap int64 `json:"dataCap"`
+	// 已经分配出去的 DataCap(bytes)，每个副本按 pieceSize 扣减
+	Used int64 `json:"used"`
+}
+
+func (c *Client) Remaining() int64 {
+	return c.DataCap - c.Used
+}
+
+func (d *DataSet) GetClient(address string) *Client {
+	for _, client := range d.Clients {
+		if client.Address == address {
+			return client
+		}
+	}
+	return nil
+}
+
+func (d *DataSet) DeleteClient(address string) bool {
+	for i, client := range d.Clients {
+		if client.Address == address {
+			d.Clients = append(d.Clients[:i], d.Clients[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// PickClient 选择本次分配使用的client。指定了 address 时只使用该地址，否则使用剩余预算最多的地址。
+// 数据集没有关联client时返回 nil, nil
+func (d *DataSet) PickClient(address string) (*Client, error) {
+	if address != "" {
+		client := d.GetClient(address)
+		if client == nil {
+			return nil, fmt.Errorf("client %s is not linked to dataset %s", address, d.DataSetName)
+		}
+		return client, nil
+	}
+
+	var best *Client
+	for _, client := range d.Clients {
+		if best == nil || client.Remaining() > best.Remaining() {
+			best = client
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,134 @@
+package distribution
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// AllocationStrategy 决定分配时依次考虑哪些piece。副本数量和组织内不重复的限制由 Allocate 保证，与策略无关
+type AllocationStrategy interface {
+	Name() string
+	// Order 返回 d.Pieces 的下标，按分配时考虑的顺序排列
+	Order(d *DataSet, req *AllocateRequest) []int
+}
+
+// Recorder 分配完成后需要在数据集中记录状态的策略
+type Recorder interface {
+	// Record allocated 为本次分配的piece下标，按分配顺序排列
+	Record(d *DataSet, allocated []int)
+}
+
+const (
+	StrategyFirstFit        = "first-fit"
+	StrategyLeastReplicated = "least-replicated"
+	StrategyRoundRobin      = "round-robin"
+	StrategyRandom          = "random"
+	StrategyBinPacking      = "bin-packing"
+)
+
+// StrategyNames 返回内置策略的名称
+func StrategyNames() []string {
+	return []string{StrategyFirstFit, StrategyLeastReplicated, StrategyRoundRobin, StrategyRandom, StrategyBinPacking}
+}
+
+// NewStrategy 按名称创建内置策略，seed 只用于 random
+func NewStrategy(name string, seed int64) (AllocationStrategy, error) {
+	switch name {
+	case "", StrategyFirstFit:
+		return FirstFit{}, nil
+	case StrategyLeastReplicated:
+		return LeastReplicated{}, nil
+	case StrategyRoundRobin:
+		return RoundRobin{}, nil
+	case StrategyRandom:
+		return Random{Seed: seed}, nil
+	case StrategyBinPacking:
+		return BinPacking{}, nil
+	}
+	return nil, fmt.Errorf("unknown strategy %s, must be one of %s", name, strings.Join(StrategyNames(), ", "))
+}
+
+func indexes(n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = i
+	}
+	return out
+}
+
+// FirstFit 按文件中的顺序
+type FirstFit struct{}
+
+func (FirstFit) Name() string { return StrategyFirstFit }
+
+func (FirstFit) Order(d *DataSet, _ *AllocateRequest) []int {
+	return indexes(len(d.Pieces))
+}
+
+// LeastReplicated 副本少的piece优先，副本数相同时按文件中的顺序
+type LeastReplicated struct{}
+
+func (LeastReplicated) Name() string { return StrategyLeastReplicated }
+
+func (LeastReplicated) Order(d *DataSet, _ *AllocateRequest) []int {
+	out := indexes(len(d.Pieces))
+	sort.SliceStable(out, func(i, j int) bool {
+		return d.Pieces[out[i]].Replicas() < d.Pieces[out[j]].Replicas()
+	})
+	return out
+}
+
+// RoundRobin 从上次分配结束的位置(d.Cursor)继续，到末尾后从头开始
+type RoundRobin struct{}
+
+func (RoundRobin) Name() string { return StrategyRoundRobin }
+
+func (RoundRobin) Order(d *DataSet, _ *AllocateRequest) []int {
+	n := len(d.Pieces)
+	out := make([]int, n)
+	for i := range out {
+		out[i] = (d.Cursor + i) % n
+	}
+	return out
+}
+
+// Record 游标移到离上次游标最远的已分配piece之后。优先级高的piece会提前分配，最后分配的不一定是最远的
+func (RoundRobin) Record(d *DataSet, allocated []int) {
+	n := len(d.Pieces)
+	if len(allocated) == 0 || n == 0 {
+		return
+	}
+	furthest := 0
+	for _, idx := range allocated {
+		if offset := ((idx-d.Cursor)%n + n) % n; offset > furthest {
+			furthest = offset
+		}
+	}
+	d.Cursor = (d.Cursor + furthest + 1) % n
+}
+
+// Random 按 Seed 打乱顺序，相同的 Seed 和数据集得到相同的结果
+type Random struct {
+	Seed int64
+}
+
+func (Random) Name() string { return StrategyRandom }
+
+func (r Random) Order(d *DataSet, _ *AllocateRequest) []int {
+	return rand.New(rand.NewSource(r.Seed)).Perm(len(d.Pieces))
+}
+
+// BinPacking 大的piece优先(first-fit decreasing)，与 FitUnder 一起使用时分配的总大小最接近 Size
+type BinPacking struct{}
+
+func (BinPacking) Name() string { return StrategyBinPacking }
+
+func (BinPacking) Order(d *DataSet, _ *AllocateRequest) []int {
+	out := indexes(len(d.Pieces))
+	sort.SliceStable(out, func(i, j int) bool {
+		return d.Pieces[out[i]].PieceSize > d.Pieces[out[j]].PieceSize
+	})
+	return out
+}
@@ -0,0 +1,218 @@
+package distribution
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// testOrgs 三个组织的sp
+var testOrgs = [][]string{
+	{"f01", "f02", "f03"},
+	{"f11", "f12"},
+	{"f21"},
+}
+
+// randomDataSet 随机生成piece的大小、优先级和标签
+func randomDataSet(r *rand.Rand) *DataSet {
+	d := &DataSet{DataSetName: "random", Duplicate: 1 + r.Intn(3)}
+	n := 1 + r.Intn(40)
+	for i := 0; i < n; i++ {
+		piece := &Piece{
+			PieceCid:  fmt.Sprintf("baga%d", i),
+			PieceSize: int64(1<<r.Intn(6)) << 30,
+			Priority:  r.Intn(3),
+		}
+		piece.CarSize = piece.PieceSize / 2
+		if r.Intn(2) == 0 {
+			piece.Tags = []string{fmt.Sprintf("t%d", r.Intn(3))}
+		}
+		d.Add(piece)
+	}
+	return d
+}
+
+// randomRequest 随机选择sp、大小、fit和标签
+func randomRequest(r *rand.Rand, strategy AllocationStrategy) *AllocateRequest {
+	org := testOrgs[r.Intn(len(testOrgs))]
+	req := &AllocateRequest{
+		Sp:       org[r.Intn(len(org))],
+		OrgSps:   org,
+		Size:     int64(1+r.Intn(200)) << 30,
+		Fit:      FitOver,
+		Strategy: strategy,
+	}
+	if r.Intn(2) == 0 {
+		req.Fit = FitUnder
+	}
+	if r.Intn(4) == 0 {
+		req.Tags = []string{fmt.Sprintf("t%d", r.Intn(3))}
+	}
+	return req
+}
+
+func cloneDataSet(t *testing.T, d *DataSet) *DataSet {
+	data, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := new(DataSet)
+	if err := json.Unmarshal(data, clone); err != nil {
+		t.Fatal(err)
+	}
+	return clone
+}
+
+// checkInvariants 副本数不超过 Duplicate，Repeat 为0时同一组织的sp不会持有同一个piece
+func checkInvariants(t *testing.T, d *DataSet) {
+	t.Helper()
+	orgOf := make(map[string]int)
+	for i, org := range testOrgs {
+		for _, sp := range org {
+			orgOf[sp] = i
+		}
+	}
+	for _, piece := range d.Pieces {
+		if piece.Replicas() > d.Duplicate {
+			t.Fatalf("%s has %d replicas, duplicate %d", piece.PieceCid, piece.Replicas(), d.Duplicate)
+		}
+		held := make(map[int]string)
+		for _, spInfo := range piece.SpInfos {
+			if spInfo.Lost {
+				continue
+			}
+			if spInfo.Num != 1 {
+				t.Fatalf("%s was sent to %s %d times with Repeat 0", piece.PieceCid, spInfo.Sp, spInfo.Num)
+			}
+			if sp, ok := held[orgOf[spInfo.Sp]]; ok {
+				t.Fatalf("%s is held by %s and %s of the same org", piece.PieceCid, sp, spInfo.Sp)
+			}
+			held[orgOf[spInfo.Sp]] = spInfo.Sp
+		}
+	}
+}
+
+// checkCursor 从旧游标开始，分配的piece都在新游标之前，下次分配不会重复经过它们
+func checkCursor(t *testing.T, d *DataSet, cursor int, result *AllocateResult) {
+	t.Helper()
+	if len(result.Pieces) == 0 {
+		return
+	}
+	n := len(d.Pieces)
+	next := (d.Cursor - cursor + n) % n
+	if next == 0 {
+		next = n
+	}
+	index := make(map[string]int)
+	for i, piece := range d.Pieces {
+		index[piece.PieceCid] = i
+	}
+	for _, piece := range result.Pieces {
+		if offset := (index[piece.PieceCid] - cursor + n) % n; offset >= next {
+			t.Fatalf("%s (offset %d from cursor %d) was allocated but the cursor moved only to %d", piece.PieceCid, offset, cursor, d.Cursor)
+		}
+	}
+}
+
+// markLost 随机把一个副本标记为丢失，之后的分配可能恢复它
+func markLost(r *rand.Rand, d *DataSet) {
+	piece := d.Pieces[r.Intn(len(d.Pieces))]
+	if len(piece.SpInfos) > 0 && r.Intn(3) == 0 {
+		piece.SpInfos[r.Intn(len(piece.SpInfos))].Lost = true
+	}
+}
+
+func TestStrategyInvariants(t *testing.T) {
+	for _, name := range StrategyNames() {
+		t.Run(name, func(t *testing.T) {
+			for seed := int64(0); seed < 200; seed++ {
+				r := rand.New(rand.NewSource(seed))
+				d := randomDataSet(r)
+				for round := 0; round < 10; round++ {
+					strategy, err := NewStrategy(name, r.Int63())
+					if err != nil {
+						t.Fatal(err)
+					}
+					req := randomRequest(r, strategy)
+					cursor := d.Cursor
+					result, err := Allocate(d, req)
+					if err != nil {
+						t.Fatalf("seed %d round %d: %v", seed, round, err)
+					}
+					if req.Fit == FitUnder && result.PieceSize > req.Size {
+						t.Fatalf("seed %d round %d: allocated %d with FitUnder, size %d", seed, round, result.PieceSize, req.Size)
+					}
+					var sum int64
+					for _, piece := range result.Pieces {
+						sum += piece.PieceSize
+						if len(req.Tags) > 0 && !piece.HasAnyTag(req.Tags) {
+							t.Fatalf("seed %d round %d: %s does not have tags %v", seed, round, piece.PieceCid, req.Tags)
+						}
+					}
+					if sum != result.PieceSize {
+						t.Fatalf("seed %d round %d: result pieceSize %d, sum of pieces %d", seed, round, result.PieceSize, sum)
+					}
+					if name == StrategyRoundRobin {
+						checkCursor(t, d, cursor, result)
+					}
+					checkInvariants(t, d)
+					markLost(r, d)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundRobinCursor(t *testing.T) {
+	cases := []struct {
+		name     string
+		cursor   int
+		priority int
+		size     int64
+		want     int
+	}{
+		{name: "from start", cursor: 0, priority: -1, size: 96 << 30, want: 3},
+		{name: "wrap", cursor: 4, priority: -1, size: 64 << 30, want: 0},
+		// 优先级高的 baga4 先分配，游标移到它之后而不是最后分配的 baga1 之后
+		{name: "priority ahead of cursor", cursor: 0, priority: 4, size: 96 << 30, want: 5},
+		// 优先级高的 baga1 在游标之前，离游标最远
+		{name: "priority behind cursor", cursor: 4, priority: 1, size: 96 << 30, want: 2},
+	}
+	for _, c := range cases {
+		d := newTestDataSet(6, 1)
+		d.Cursor = c.cursor
+		if c.priority >= 0 {
+			d.Pieces[c.priority].Priority = 1
+		}
+		req := &AllocateRequest{Sp: "f01", Size: c.size, Fit: FitUnder, Strategy: RoundRobin{}}
+		if _, err := Allocate(d, req); err != nil {
+			t.Fatal(err)
+		}
+		if d.Cursor != c.want {
+			t.Errorf("%s: got cursor %d, want %d", c.name, d.Cursor, c.want)
+		}
+	}
+}
+
+func TestRandomDeterministic(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		d := randomDataSet(r)
+		req := randomRequest(r, Random{Seed: seed})
+
+		a, b := cloneDataSet(t, d), cloneDataSet(t, d)
+		resultA, err := Allocate(a, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resultB, err := Allocate(b, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(resultA, resultB) || !reflect.DeepEqual(a, b) {
+			t.Fatalf("seed %d: random strategy is not deterministic", seed)
+		}
+	}
+}
@@ -1,13 +1,17 @@
-module distribution
+module github.com/gh-efforts/distribution
 
 go 1.19
 
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/liushuochen/gotable v0.0.0-20221119160816-1113793e7092
+	github.com/mitchellh/go-homedir v1.1.0
+	github.com/urfave/cli/v2 v2.25.5
+	golang.org/x/sys v0.8.0
+)
+
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.2 // indirect
-	github.com/liushuochen/gotable v0.0.0-20221119160816-1113793e7092 // indirect
-	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
-	github.com/urfave/cli/v2 v2.25.5 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
-	golang.org/x/sys v0.8.0 // indirect
 )
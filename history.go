@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// historyDateFormat 每天每个数据集记录一条，按UTC日期
+const historyDateFormat = "2006-01-02"
+
+func historyFile() string {
+	return path.Join(repoDir, "history.json")
+}
+
+// DataSetMetrics 数据集某一天结束时(或最后一次修改后)的指标
+type DataSetMetrics struct {
+	Date        string `json:"date"`
+	DataSetName string `json:"dataSetName"`
+	Pieces      int    `json:"pieces"`
+	Replicas    int    `json:"replicas"`
+	// 全部副本的pieceSize总和(bytes)
+	Distributed int64   `json:"distributed"`
+	Complete    float64 `json:"complete"`
+	Remaining   int64   `json:"remaining"`
+	Orgs        int     `json:"orgs"`
+	Sps         int     `json:"sps"`
+}
+
+// History 数据集进度的历史记录，每次修改仓库后更新当天的记录
+type History struct {
+	List []*DataSetMetrics `json:"list"`
+}
+
+func ReadHistory() (*History, error) {
+	h := new(History)
+	data, err := os.ReadFile(historyFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	return h, nil
+}
+
+func (h *History) Write() error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(historyFile(), data, 0644)
+}
+
+// Record 用仓库当前状态替换 now 当天每个数据集的记录
+func (h *History) Record(repo *Repo, now time.Time) {
+	date := now.UTC().Format(historyDateFormat)
+	for _, dataSet := range repo.DataSets.List {
+		stats := NewDataSetStats(dataSet, repo.Users)
+		metrics := &DataSetMetrics{
+			Date:        date,
+			DataSetName: dataSet.DataSetName,
+			Pieces:      stats.Pieces,
+			Distributed: stats.Distributed,
+			Complete:    stats.Complete,
+			Remaining:   stats.Remaining,
+			Orgs:        len(stats.Orgs),
+			Sps:         len(stats.Sps),
+		}
+		for _, sp := range stats.Sps {
+			metrics.Replicas += sp.Replicas
+		}
+		replaced := false
+		for i, m := range h.List {
+			if m.Date == date && m.DataSetName == dataSet.DataSetName {
+				h.List[i] = metrics
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			h.List = append(h.List, metrics)
+		}
+	}
+}
+
+// RecordHistory 读取历史记录，记录仓库当前状态后写回
+func RecordHistory(repo *Repo, now time.Time) error {
+	h, err := ReadHistory()
+	if err != nil {
+		return err
+	}
+	h.Record(repo, now)
+	return h.Write()
+}
+
+// Series 返回数据集从 since 到 now 每天的指标，没有记录的日期沿用前一天的值
+func (h *History) Series(dataSetName string, since, now time.Time) []*DataSetMetrics {
+	var records []*DataSetMetrics
+	for _, m := range h.List {
+		if m.DataSetName == dataSetName {
+			records = append(records, m)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Date < records[j].Date
+	})
+	if len(records) == 0 {
+		return nil
+	}
+
+	start := since.UTC().Format(historyDateFormat)
+	if records[0].Date > start {
+		start = records[0].Date
+	}
+	day, _ := time.Parse(historyDateFormat, start)
+	end := now.UTC().Format(historyDateFormat)
+
+	var out []*DataSetMetrics
+	var last *DataSetMetrics
+	i := 0
+	for date := day.Format(historyDateFormat); date <= end; date = day.Format(historyDateFormat) {
+		for i < len(records) && records[i].Date <= date {
+			last = records[i]
+			i++
+		}
+		if last != nil {
+			m := *last
+			m.Date = date
+			out = append(out, &m)
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return out
+}
+
+// WriteProgress 以 csv、json 或 svg 格式输出进度
+func WriteProgress(w io.Writer, format, dataSetName string, series []*DataSetMetrics) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(series, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"date", "pieces", "replicas", "distributed(TiB)", "complete", "remaining(TiB)", "orgs", "sps"}); err != nil {
+			return err
+		}
+		for _, m := range series {
+			record := []string{m.Date, strconv.Itoa(m.Pieces), strconv.Itoa(m.Replicas), strconv.FormatFloat(float64(m.Distributed)/(1<<40), 'f', -1, 64),
+				strconv.FormatFloat(m.Complete, 'f', 4, 64), strconv.FormatFloat(float64(m.Remaining)/(1<<40), 'f', -1, 64), strconv.Itoa(m.Orgs), strconv.Itoa(m.Sps)}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "svg":
+		return writeProgressSvg(w, dataSetName, series)
+	}
+	return fmt.Errorf("unknown format %s, must be csv, json or svg", format)
+}
+
+// writeProgressSvg 输出完成进度(0-100%)的折线图，不依赖外部资源，可以直接贴到 GitHub issue 中
+func writeProgressSvg(w io.Writer, dataSetName string, series []*DataSetMetrics) error {
+	const (
+		width, height = 800, 320
+		left, right   = 60, 20
+		top, bottom   = 40, 50
+	)
+	plotW, plotH := float64(width-left-right), float64(height-top-bottom)
+	x := func(i int) float64 {
+		if len(series) < 2 {
+			return left + plotW/2
+		}
+		return left + plotW*float64(i)/float64(len(series)-1)
+	}
+	y := func(complete float64) float64 {
+		return top + plotH*(1-complete)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`+"\n", width, height, width, height)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="white"/>`+"\n", width, height)
+	fmt.Fprintf(&b, `<text x="%d" y="24" font-size="16">%s replication progress</text>`+"\n", left, html.EscapeString(dataSetName))
+	for _, p := range []float64{0, 0.25, 0.5, 0.75, 1} {
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#ddd"/>`+"\n", left, y(p), width-right, y(p))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%.0f%%</text>`+"\n", left-6, y(p)+4, p*100)
+	}
+	if len(series) > 0 {
+		for _, i := range []int{0, len(series) / 2, len(series) - 1} {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`+"\n", x(i), height-bottom+20, series[i].Date)
+		}
+		var points []string
+		for i, m := range series {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(i), y(m.Complete)))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="#0366d6" stroke-width="2"/>`+"\n", strings.Join(points, " "))
+		lastIndex := len(series) - 1
+		last := series[lastIndex]
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="#0366d6"/>`+"\n", x(lastIndex), y(last.Complete))
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%.2f%% complete, %.2fTiB distributed, %d orgs, %d sps</text>`+"\n",
+			width-right, height-10, last.Complete*100, float64(last.Distributed)/(1<<40), last.Orgs, last.Sps)
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
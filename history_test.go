@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistorySeries(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2026, 10, d, 12, 0, 0, 0, time.UTC)
+	}
+	h := new(History)
+	repo := newTestRepo(day(1))
+	h.Record(repo, day(1))
+	// 10-02 没有记录；10-03 d1 的每个piece都有3个副本，超过 Duplicate 2，进度不能超过1
+	for _, piece := range repo.DataSets.GetDataset("d1").Pieces {
+		piece.SpInfos = []*SpInfo{{Sp: "f1", Num: 1}, {Sp: "f2", Num: 1}, {Sp: "f9", Num: 1}}
+	}
+	h.Record(repo, day(3))
+
+	cases := []struct {
+		name     string
+		dataSet  string
+		since    time.Time
+		dates    []string
+		complete []float64
+	}{
+		{
+			// since 早于第一条记录时从第一条记录开始
+			name:     "since before first record",
+			dataSet:  "d1",
+			since:    time.Date(2026, 9, 28, 0, 0, 0, 0, time.UTC),
+			dates:    []string{"2026-10-01", "2026-10-02", "2026-10-03", "2026-10-04"},
+			complete: []float64{0.5, 0.5, 1, 1},
+		},
+		{
+			// 没有记录的日期沿用前一天的值
+			name:     "missing day",
+			dataSet:  "d1",
+			since:    day(2),
+			dates:    []string{"2026-10-02", "2026-10-03", "2026-10-04"},
+			complete: []float64{0.5, 1, 1},
+		},
+		{name: "unknown dataset", dataSet: "none", since: day(1)},
+	}
+	for _, c := range cases {
+		series := h.Series(c.dataSet, c.since, day(4))
+		var dates []string
+		var complete []float64
+		for _, m := range series {
+			dates = append(dates, m.Date)
+			complete = append(complete, m.Complete)
+		}
+		if !reflect.DeepEqual(dates, c.dates) || !reflect.DeepEqual(complete, c.complete) {
+			t.Errorf("%s: got %v %v, want %v %v", c.name, dates, complete, c.dates, c.complete)
+		}
+	}
+
+	// 同一天再次记录时替换当天的记录
+	h.Record(repo, day(3))
+	if len(h.List) != 4 {
+		t.Fatalf("got %d records, want 4, one per dataset and day", len(h.List))
+	}
+}
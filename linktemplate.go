@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// defaultLinkTemplate 没有配置链接模板时使用，与原来的 prefix + pieceCid + suffix 相同
+const defaultLinkTemplate = "{{.BaseURL}}{{.PieceCid}}{{.Suffix}}"
+
+// LinkData 链接模板中可以使用的字段
+type LinkData struct {
+	// 下载源的 baseUrl，没有下载源时为 --prefix
+	BaseURL      string
+	Suffix       string
+	DataSetName  string
+	PieceCid     string
+	DataCid      string
+	PieceSize    int64
+	CarSize      int64
+	Sha256       string
+	Sp           string
+	AllocationID int64
+}
+
+// setPiece 填入数据集和piece的字段
+func (l *LinkData) setPiece(dataSet *DataSet, piece *Piece) {
+	l.DataSetName = dataSet.DataSetName
+	l.PieceCid = piece.PieceCid
+	l.DataCid = piece.DataCid
+	l.PieceSize = piece.PieceSize
+	l.CarSize = piece.CarSize
+	l.Sha256 = piece.Sha256
+}
+
+// linkTemplates 已经解析过的模板，同一个模板在一次分配中会被执行很多次
+var linkTemplates = map[string]*template.Template{}
+
+// ParseLinkTemplate 解析链接模板，并用示例数据执行一次，以便在配置时就发现不存在的字段
+func ParseLinkTemplate(text string) (*template.Template, error) {
+	if tmpl, ok := linkTemplates[text]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := template.New("link").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link template %q: %w", text, err)
+	}
+	sample := &LinkData{BaseURL: "https://example.com/", Suffix: ".car", DataSetName: "dataset", PieceCid: "baga", DataCid: "bafy", Sp: "f01000"}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("invalid link template %q: %w", text, err)
+	}
+	linkTemplates[text] = tmpl
+	return tmpl, nil
+}
+
+// ExecuteLinkTemplate 按模板生成下载链接，text 为空时使用 defaultLinkTemplate
+func ExecuteLinkTemplate(text string, data *LinkData) (string, error) {
+	if text == "" {
+		text = defaultLinkTemplate
+	}
+	tmpl, err := ParseLinkTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// LinkPath 按模板生成相对下载源根目录的路径：BaseURL 置空后执行模板，去掉查询参数和开头的 /。
+// 模板没有使用 BaseURL 而是写了完整链接时，取链接的路径部分
+func LinkPath(text string, data *LinkData) (string, error) {
+	link := *data
+	link.BaseURL = ""
+	s, err := ExecuteLinkTemplate(text, &link)
+	if err != nil {
+		return "", err
+	}
+	if i := strings.IndexAny(s, "?#"); i >= 0 {
+		s = s[:i]
+	}
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil {
+			return "", err
+		}
+		s = u.Path
+	}
+	return strings.TrimLeft(s, "/"), nil
+}
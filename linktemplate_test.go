@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestLinkPath(t *testing.T) {
+	data := &LinkData{BaseURL: "https://mirror.example.com/root/", Suffix: ".car", DataSetName: "ds", PieceCid: "baga1", DataCid: "bafy1"}
+	cases := []struct {
+		text string
+		path string
+	}{
+		{text: "", path: "baga1.car"},
+		{text: "{{.BaseURL}}{{.DataSetName}}/{{.PieceCid}}.car", path: "ds/baga1.car"},
+		{text: "{{.BaseURL}}/{{.DataSetName}}/{{.DataCid}}/{{.PieceCid}}.car?sig=abc", path: "ds/bafy1/baga1.car"},
+		// 模板没有使用 BaseURL 时取链接的路径部分
+		{text: "https://cdn.example.com/x/{{.PieceCid}}.car#part", path: "x/baga1.car"},
+	}
+	for _, c := range cases {
+		path, err := LinkPath(c.text, data)
+		if err != nil {
+			t.Fatalf("%q: %v", c.text, err)
+		}
+		if path != c.path {
+			t.Errorf("%q: got %s, want %s", c.text, path, c.path)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile 同一台机器上同时只能有一个进程操作仓库
+func lockFile() string {
+	return os.TempDir() + "/myapp.lock"
+}
+
+// lockRepo 获取文件锁，block 为 false 时锁被占用立即返回 syscall.EWOULDBLOCK。关闭返回的文件即释放锁
+func lockRepo(block bool) (*os.File, error) {
+	// 打开或者创建 lockFile 文件
+	file, err := os.OpenFile(lockFile(), os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_EX
+	if !block {
+		how |= syscall.LOCK_NB
+	}
+	if err := unix.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LotusClient 访问 lotus 全节点 JSON-RPC 接口的最小客户端
+type LotusClient struct {
+	Endpoint string
+	Token    string
+	HTTP     *http.Client
+}
+
+// NewLotusClient 解析 FULLNODE_API_INFO 格式(token:/ip4/127.0.0.1/tcp/1234/http)的地址，也接受 http(s) URL
+func NewLotusClient(apiInfo string) (*LotusClient, error) {
+	apiInfo = strings.TrimSpace(apiInfo)
+	if apiInfo == "" {
+		return nil, fmt.Errorf("lotus api is not specified")
+	}
+
+	var token string
+	addr := apiInfo
+	isURL := func(s string) bool {
+		return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+	}
+	// token 与地址之间用第一个冒号分隔，地址可以是 multiaddr 或 URL
+	if i := strings.Index(apiInfo, ":"); i > 0 && !isURL(apiInfo) {
+		if rest := apiInfo[i+1:]; strings.HasPrefix(rest, "/") || isURL(rest) {
+			token, addr = apiInfo[:i], rest
+		}
+	}
+
+	endpoint := addr
+	if strings.HasPrefix(addr, "/") {
+		parts := strings.Split(strings.Trim(addr, "/"), "/")
+		if len(parts) < 4 || parts[2] != "tcp" {
+			return nil, fmt.Errorf("unsupported lotus api multiaddr %s", addr)
+		}
+		scheme := "http"
+		if len(parts) > 4 && (parts[4] == "https" || parts[4] == "wss") {
+			scheme = "https"
+		}
+		host := parts[1]
+		if parts[0] == "ip6" {
+			host = "[" + host + "]"
+		}
+		endpoint = fmt.Sprintf("%s://%s:%s/rpc/v0", scheme, host, parts[3])
+	} else if !isURL(addr) {
+		return nil, fmt.Errorf("unsupported lotus api %s", addr)
+	}
+
+	return &LotusClient{Endpoint: endpoint, Token: token, HTTP: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+type rpcRequest struct {
+	Jsonrpc string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (c *LotusClient) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	body, err := json.Marshal(&rpcRequest{Jsonrpc: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", method, resp.Status)
+	}
+
+	var out rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return err
+	}
+	if out.Error != nil {
+		return fmt.Errorf("%s: %s (code %d)", method, out.Error.Message, out.Error.Code)
+	}
+	return json.Unmarshal(out.Result, result)
+}
+
+// VerifiedClientStatus 查询地址链上剩余的 DataCap(bytes)，不是 verified client 时返回 0
+func (c *LotusClient) VerifiedClientStatus(ctx context.Context, address string) (*big.Int, error) {
+	var dataCap *string
+	if err := c.call(ctx, "Filecoin.StateVerifiedClientStatus", &dataCap, address, []interface{}{}); err != nil {
+		return nil, err
+	}
+	if dataCap == nil {
+		return new(big.Int), nil
+	}
+	n, ok := new(big.Int).SetString(*dataCap, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid DataCap %s", *dataCap)
+	}
+	return n, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestNewLotusClient(t *testing.T) {
+	cases := []struct {
+		apiInfo  string
+		endpoint string
+		token    string
+		err      bool
+	}{
+		{apiInfo: "tok:/ip4/127.0.0.1/tcp/1234/http", endpoint: "http://127.0.0.1:1234/rpc/v0", token: "tok"},
+		{apiInfo: "/ip4/10.0.0.1/tcp/1234/http", endpoint: "http://10.0.0.1:1234/rpc/v0"},
+		{apiInfo: "tok:/ip6/::1/tcp/1234/https", endpoint: "https://[::1]:1234/rpc/v0", token: "tok"},
+		{apiInfo: "tok:/dns4/lotus.example.com/tcp/443/wss", endpoint: "https://lotus.example.com:443/rpc/v0", token: "tok"},
+		{apiInfo: "https://lotus.example.com/rpc/v1", endpoint: "https://lotus.example.com/rpc/v1"},
+		{apiInfo: "tok:https://lotus.example.com/rpc/v1", endpoint: "https://lotus.example.com/rpc/v1", token: "tok"},
+		{apiInfo: " ", err: true},
+		{apiInfo: "tok:/ip4/127.0.0.1/udp/1234", err: true},
+		{apiInfo: "lotus.example.com:1234", err: true},
+	}
+	for _, c := range cases {
+		client, err := NewLotusClient(c.apiInfo)
+		if c.err {
+			if err == nil {
+				t.Errorf("%q: expected an error, got endpoint %s", c.apiInfo, client.Endpoint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.apiInfo, err)
+			continue
+		}
+		if client.Endpoint != c.endpoint || client.Token != c.token {
+			t.Errorf("%q: got endpoint %s token %q, want %s %q", c.apiInfo, client.Endpoint, client.Token, c.endpoint, c.token)
+		}
+	}
+}
+
+// lotusStub 对 StateVerifiedClientStatus 返回固定的响应体
+func lotusStub(t *testing.T, response string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer tok" {
+			t.Errorf("authorization header %q", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(rpcRequest)
+		if err := json.Unmarshal(body, req); err != nil {
+			t.Errorf("invalid request %s: %v", body, err)
+		}
+		if req.Method != "Filecoin.StateVerifiedClientStatus" || len(req.Params) != 2 || req.Params[0] != "f1client" {
+			t.Errorf("unexpected request %s", body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, response)
+	}))
+}
+
+func TestVerifiedClientStatus(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		dataCap  string
+		err      string
+	}{
+		{name: "not verified", response: `{"jsonrpc":"2.0","id":1,"result":null}`, dataCap: "0"},
+		{name: "datacap", response: `{"jsonrpc":"2.0","id":1,"result":"1125899906842624"}`, dataCap: "1125899906842624"},
+		{name: "rpc error", response: `{"jsonrpc":"2.0","id":1,"error":{"code":1,"message":"resolution lookup failed"}}`, err: "resolution lookup failed (code 1)"},
+		{name: "invalid datacap", response: `{"jsonrpc":"2.0","id":1,"result":"abc"}`, err: "invalid DataCap abc"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := lotusStub(t, c.response)
+			defer server.Close()
+
+			client, err := NewLotusClient("tok:" + server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dataCap, err := client.VerifiedClientStatus(context.Background(), "f1client")
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Fatalf("expected error %q, got %v", c.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dataCap.String() != c.dataCap {
+				t.Fatalf("got DataCap %s, want %s", dataCap, c.dataCap)
+			}
+		})
+	}
+}
+
+func TestCheckOnChainDataCap(t *testing.T) {
+	server := lotusStub(t, `{"jsonrpc":"2.0","id":1,"result":"1099511627776"}`)
+	defer server.Close()
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	set.String("lotus-api", "tok:"+server.URL, "")
+	ctx := cli.NewContext(cli.NewApp(), set, nil)
+	dataCap, err := checkOnChainDataCap(ctx, "f1client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dataCap != 1<<40 {
+		t.Fatalf("got DataCap %d, want %d", dataCap, int64(1<<40))
+	}
+}
@@ -5,9 +5,9 @@ import (
 	"fmt"
 	"github.com/mitchellh/go-homedir"
 	"github.com/urfave/cli/v2"
-	"golang.org/x/sys/unix"
 	"log"
 	"os"
+	"os/user"
 	"path"
 	"syscall"
 )
@@ -21,6 +21,16 @@ func main() {
 			userManager,
 			dataSetManager,
 			pieceManager,
+			repoManager,
+			auditManager,
+			allocManager,
+			clientManager,
+			mirrorManager,
+			spManager,
+			configManager,
+			reportManager,
+			daemonCmd,
+			tuiCmd,
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -28,24 +38,35 @@ func main() {
 				EnvVars: []string{"DIST_PATH"},
 				Value:   "~/.dist",
 			},
+			&cli.StringFlag{
+				Name:    "operator",
+				Usage:   "operator name recorded in the audit log, default use $USER",
+				EnvVars: []string{"DIST_OPERATOR", "USER"},
+			},
+			&cli.IntFlag{
+				Name:    "snapshot-keep",
+				Usage:   "number of repo snapshots to keep, 0 means unlimited",
+				EnvVars: []string{"DIST_SNAPSHOT_KEEP"},
+				Value:   100,
+			},
+			&cli.DurationFlag{
+				Name:    "snapshot-max-age",
+				Usage:   "remove repo snapshots older than this, 0 means never",
+				EnvVars: []string{"DIST_SNAPSHOT_MAX_AGE"},
+			},
 		},
 		Before: func(ctx *cli.Context) error {
-			// 打开或者创建 lockFile 文件
-			file, err := os.OpenFile(os.TempDir()+"/myapp.lock", os.O_RDWR|os.O_CREATE, 0666)
-			if err != nil {
-				panic(err)
-			}
-			//defer file.Close()
-
-			// 尝试获取文件锁
-			err = unix.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
-			if err != nil {
-				if err == syscall.EWOULDBLOCK {
-					fmt.Println("Another instance is already running...")
-				} else {
-					panic(err)
+			// 尝试获取文件锁，进程退出时释放。daemon 和 tui 长期运行，只在读写仓库时加锁
+			if cmd := ctx.Args().First(); cmd != daemonCmd.Name && cmd != tuiCmd.Name {
+				_, err := lockRepo(false)
+				if err != nil {
+					if err == syscall.EWOULDBLOCK {
+						fmt.Println("Another instance is already running...")
+					} else {
+						panic(err)
+					}
+					os.Exit(1)
 				}
-				os.Exit(1)
 			}
 
 			homeDir, err := homedir.Expand(ctx.String("repo"))
@@ -62,8 +83,31 @@ func main() {
 					}
 				}
 			}
+			repoDir = homeDir
+			operator = ctx.String("operator")
+			if operator == "" {
+				if u, err := user.Current(); err == nil {
+					operator = u.Username
+				}
+			}
+			configFile = path.Join(homeDir, "config.toml")
+			repoConfig, err = LoadConfig(configFile)
+			if err != nil {
+				return err
+			}
+			repoConfig.ApplyFlagDefaults(ctx.App.Commands)
+			snapshotKeep = repoConfig.Snapshot.Keep
+			if ctx.IsSet("snapshot-keep") {
+				snapshotKeep = ctx.Int("snapshot-keep")
+			}
+			snapshotMaxAge, _ = repoConfig.SnapshotMaxAge()
+			if ctx.IsSet("snapshot-max-age") {
+				snapshotMaxAge = ctx.Duration("snapshot-max-age")
+			}
 			orgsJson = path.Join(homeDir, "users.json")
 			dataSetsJson = path.Join(homeDir, "datasets.json")
+			allocationsJson = path.Join(homeDir, "allocations.json")
+			mirrorsJson = path.Join(homeDir, "mirrors.json")
 
 			return nil
 		},
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ManifestPiece json/ndjson 下载清单中的一个文件
+type ManifestPiece struct {
+	PieceCid string `json:"pieceCid"`
+	DataCid  string `json:"dataCid,omitempty"`
+	URL      string `json:"url"`
+	// 包括 url 在内的全部下载源，按优先级排序
+	Mirrors   []string `json:"mirrors,omitempty"`
+	FileName  string   `json:"fileName"`
+	PieceSize int64    `json:"pieceSize"`
+	CarSize   int64    `json:"carSize"`
+	Sha256    string   `json:"sha256,omitempty"`
+}
+
+func manifestPiece(item *OutputItem) *ManifestPiece {
+	piece := &ManifestPiece{
+		PieceCid:  item.Piece.PieceCid,
+		DataCid:   item.Piece.DataCid,
+		URL:       item.URL(),
+		FileName:  item.FileName(),
+		PieceSize: item.Piece.PieceSize,
+		CarSize:   item.Piece.CarSize,
+		Sha256:    item.Piece.Sha256,
+	}
+	if len(item.URLs) > 1 {
+		piece.Mirrors = item.URLs
+	}
+	return piece
+}
+
+// writeAria2 输出 aria2c --input-file 使用的文件
+func writeAria2(w io.Writer, out *Output) error {
+	for _, item := range out.Items {
+		var b strings.Builder
+		// aria2 同一行用tab分隔的多个链接是同一个文件的不同下载源
+		fmt.Fprintf(&b, "%s\n  out=%s\n", strings.Join(item.URLs, "\t"), item.FileName())
+		if item.Piece.Sha256 != "" {
+			fmt.Fprintf(&b, "  checksum=sha-256=%s\n", item.Piece.Sha256)
+		}
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeWget 输出逐个下载并校验的 wget 脚本
+func writeWget(w io.Writer, out *Output) error {
+	return writeDownloadScript(w, out, func(url, name string) string {
+		return fmt.Sprintf("wget -c -O %s %s", shellQuote(name), shellQuote(url))
+	})
+}
+
+// writeCurl 输出逐个下载并校验的 curl 脚本
+func writeCurl(w io.Writer, out *Output) error {
+	return writeDownloadScript(w, out, func(url, name string) string {
+		return fmt.Sprintf("curl -fL -C - -o %s %s", shellQuote(name), shellQuote(url))
+	})
+}
+
+func writeDownloadScript(w io.Writer, out *Output, download func(url, name string) string) error {
+	var b strings.Builder
+	b.WriteString("#!/usr/bin/env bash\nset -euo pipefail\n\n")
+	for _, item := range out.Items {
+		name := item.FileName()
+		var commands []string
+		for _, url := range item.URLs {
+			commands = append(commands, download(url, name))
+		}
+		// 前一个下载源失败时使用下一个
+		b.WriteString(strings.Join(commands, " || ") + "\n")
+		if item.Piece.Sha256 != "" {
+			fmt.Fprintf(&b, "echo %s | sha256sum -c -\n", shellQuote(item.Piece.Sha256+"  "+name))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeRcloneFilter 输出 rclone --filter-from 使用的过滤规则，只包含本次分配的文件。
+// 规则使用相对下载源根目录的路径，链接模板带有目录时也能匹配
+func writeRcloneFilter(w io.Writer, out *Output) error {
+	var b strings.Builder
+	for _, item := range out.Items {
+		file := item.Path
+		if file == "" {
+			file = item.FileName()
+		}
+		fmt.Fprintf(&b, "+ /%s\n", file)
+	}
+	b.WriteString("- **\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeJson 输出包含汇总信息的json文档
+func writeJson(w io.Writer, out *Output) error {
+	doc := struct {
+		Pieces  []*ManifestPiece `json:"pieces"`
+		Summary *OutputSummary   `json:"summary,omitempty"`
+	}{Pieces: []*ManifestPiece{}, Summary: out.Summary}
+	for _, item := range out.Items {
+		doc.Pieces = append(doc.Pieces, manifestPiece(item))
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// writeNdjson 每个文件输出一行json
+func writeNdjson(w io.Writer, out *Output) error {
+	enc := json.NewEncoder(w)
+	for _, item := range out.Items {
+		if err := enc.Encode(manifestPiece(item)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MembershipChange 一个sp所属org的变化，From 为空表示加入，To 为空表示移除
+type MembershipChange struct {
+	Sp   string `json:"sp"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+func (c *MembershipChange) String() string {
+	switch {
+	case c.From == "":
+		return fmt.Sprintf("+ %s -> %s", c.Sp, c.To)
+	case c.To == "":
+		return fmt.Sprintf("- %s <- %s", c.Sp, c.From)
+	default:
+		return fmt.Sprintf("~ %s %s -> %s", c.Sp, c.From, c.To)
+	}
+}
+
+// AddSp 把sp加入org，sp已经在其他org中时返回错误，已经在该org中时返回nil
+func (u *Users) AddSp(org, sp string) (*MembershipChange, error) {
+	user := u.Get(org)
+	if user == nil {
+		return nil, fmt.Errorf("org %s not found", org)
+	}
+	if owner := u.GetBySp(sp); owner != nil {
+		if owner.Org == org {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%s already belongs to org %s, use move-sp instead", sp, owner.Org)
+	}
+	user.Providers = append(user.Providers, &Provider{Sp: sp})
+	return &MembershipChange{Sp: sp, To: org}, nil
+}
+
+// RemoveSp 把sp移出org，sp的属性一起删除
+func (u *Users) RemoveSp(org, sp string) (*MembershipChange, error) {
+	user := u.Get(org)
+	if user == nil {
+		return nil, fmt.Errorf("org %s not found", org)
+	}
+	if user.removeProvider(sp) == nil {
+		return nil, fmt.Errorf("%s does not belong to org %s", sp, org)
+	}
+	return &MembershipChange{Sp: sp, From: org}, nil
+}
+
+// MoveSp 把sp从一个org移到另一个org，sp的属性一起移动
+func (u *Users) MoveSp(from, to, sp string) (*MembershipChange, error) {
+	src, dst := u.Get(from), u.Get(to)
+	if src == nil {
+		return nil, fmt.Errorf("org %s not found", from)
+	}
+	if dst == nil {
+		return nil, fmt.Errorf("org %s not found", to)
+	}
+	if from == to {
+		return nil, fmt.Errorf("%s is already in org %s", sp, to)
+	}
+	p := src.removeProvider(sp)
+	if p == nil {
+		return nil, fmt.Errorf("%s does not belong to org %s", sp, from)
+	}
+	dst.Providers = append(dst.Providers, p)
+	return &MembershipChange{Sp: sp, From: from, To: to}, nil
+}
+
+// removeProvider 把sp移出组织并返回它的属性，sp不在组织中时返回nil
+func (u *User) removeProvider(sp string) *Provider {
+	for i, p := range u.Providers {
+		if p.Sp == sp {
+			u.Providers = append(u.Providers[:i], u.Providers[i+1:]...)
+			return p
+		}
+	}
+	return nil
+}
+
+// Validate 检查每个sp只属于一个org，否则 GetSps 和 GetBySp 的结果不确定
+func (u *Users) Validate() error {
+	owners := make(map[string]string)
+	for _, user := range u.List {
+		for _, sp := range user.Sps() {
+			if strings.TrimSpace(sp) == "" {
+				return fmt.Errorf("org %s has an empty sp", user.Org)
+			}
+			if owner, ok := owners[sp]; ok {
+				if owner == user.Org {
+					return fmt.Errorf("%s is listed twice in org %s", sp, owner)
+				}
+				return fmt.Errorf("%s belongs to both org %s and org %s", sp, owner, user.Org)
+			}
+			owners[sp] = user.Org
+		}
+	}
+	return nil
+}
+
+// LostReplicas 一个数据集中受影响的副本
+type LostReplicas struct {
+	DataSetName string `json:"dataSetName"`
+	Pieces      int    `json:"pieces"`
+	Replicas    int    `json:"replicas"`
+	// 受影响副本的pieceSize总和(bytes)
+	PieceSize int64 `json:"pieceSize"`
+}
+
+// MarkLost 统计 sps 在每个数据集中没有丢失的副本，mark 为 true 时把它们标记为丢失
+func (r *Repo) MarkLost(sps []string, mark bool) []*LostReplicas {
+	var out []*LostReplicas
+	for _, dataSet := range r.DataSets.List {
+		lost := &LostReplicas{DataSetName: dataSet.DataSetName}
+		for _, piece := range dataSet.Pieces {
+			affected := false
+			for _, spInfo := range piece.SpInfos {
+				if spInfo.Lost || !containsString(sps, spInfo.Sp) {
+					continue
+				}
+				affected = true
+				lost.Replicas++
+				lost.PieceSize += piece.PieceSize
+				if mark {
+					spInfo.Lost = true
+				}
+			}
+			if affected {
+				lost.Pieces++
+			}
+		}
+		if lost.Replicas > 0 {
+			out = append(out, lost)
+		}
+	}
+	return out
+}
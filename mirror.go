@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var mirrorsJson string
+
+// Mirror 存放car文件的一个下载源
+type Mirror struct {
+	Name    string `json:"name"`
+	BaseURL string `json:"baseUrl"`
+	Region  string `json:"region"`
+	// 下载带宽(Gbps)，同区域内优先使用带宽大的
+	Capacity float64 `json:"capacity,omitempty"`
+	// 优先级，数字小的优先
+	Priority int `json:"priority"`
+	// 不可用的下载源不会出现在下载链接中
+	Down       bool   `json:"down,omitempty"`
+	DownReason string `json:"downReason,omitempty"`
+	// 链接模板，为空时使用数据集的链接模板
+	Template string `json:"template,omitempty"`
+}
+
+type Mirrors struct {
+	List []*Mirror `json:"list"`
+}
+
+func NewMirrors() *Mirrors {
+	return new(Mirrors)
+}
+
+// ReadMirrorsFromFile 从JSON文件中读取Mirrors结构体
+func (m *Mirrors) ReadMirrorsFromFile() error {
+	return readJsonFile(mirrorsJson, m)
+}
+
+// WriteMirrorsToFile 将Mirrors结构体写入到JSON文件中
+func (m *Mirrors) WriteMirrorsToFile() error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(mirrorsJson, data, 0644)
+}
+
+func (m *Mirrors) Get(name string) *Mirror {
+	for _, mirror := range m.List {
+		if mirror.Name == name {
+			return mirror
+		}
+	}
+	return nil
+}
+
+func (m *Mirrors) Add(mirror *Mirror) {
+	m.List = append(m.List, mirror)
+}
+
+func (m *Mirrors) Delete(name string) bool {
+	for i, mirror := range m.List {
+		if mirror.Name == name {
+			m.List = append(m.List[:i], m.List[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// regionDistance 区域相同为0，大区相同(如 asia-east 与 asia-south)为1，否则为2
+func regionDistance(a, b string) int {
+	if a == "" || b == "" {
+		return 2
+	}
+	if a == b {
+		return 0
+	}
+	if regionArea(a) == regionArea(b) {
+		return 1
+	}
+	return 2
+}
+
+func regionArea(region string) string {
+	if i := strings.IndexAny(region, "-/"); i >= 0 {
+		return region[:i]
+	}
+	return region
+}
+
+// mirrorNames piece 指定了下载源时只使用 piece 的，否则使用数据集的，都没有时使用配置文件中的默认下载源
+func mirrorNames(dataSet *DataSet, piece *Piece) []string {
+	names := dataSet.Mirrors
+	if len(piece.Mirrors) > 0 {
+		names = piece.Mirrors
+	}
+	if len(names) == 0 {
+		names = repoConfig.Mirrors.Default
+	}
+	return names
+}
+
+// Select 按离 region 的远近、优先级、带宽对可用的下载源排序
+func (m *Mirrors) Select(dataSet *DataSet, piece *Piece, region string) []*Mirror {
+	var out []*Mirror
+	for _, name := range mirrorNames(dataSet, piece) {
+		if mirror := m.Get(name); mirror != nil && !mirror.Down {
+			out = append(out, mirror)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		di, dj := regionDistance(region, out[i].Region), regionDistance(region, out[j].Region)
+		if di != dj {
+			return di < dj
+		}
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority < out[j].Priority
+		}
+		return out[i].Capacity > out[j].Capacity
+	})
+	return out
+}
+
+// PieceURLs 返回piece的下载链接。link 中 BaseURL 为 --prefix，没有配置下载源时使用它生成链接，all 为 false 时只返回离 region 最近的一个。
+// 配置了下载源但都不可用时返回错误。下载源配置了链接模板时优先使用，其次使用数据集的链接模板
+func (m *Mirrors) PieceURLs(dataSet *DataSet, piece *Piece, link LinkData, region string, all bool) ([]string, error) {
+	link.setPiece(dataSet, piece)
+	mirrors, err := m.available(dataSet, piece, region)
+	if err != nil {
+		return nil, err
+	}
+	if len(mirrors) == 0 {
+		url, err := ExecuteLinkTemplate(dataSet.LinkTemplate, &link)
+		if err != nil {
+			return nil, err
+		}
+		return []string{url}, nil
+	}
+	if !all {
+		mirrors = mirrors[:1]
+	}
+	var urls []string
+	for _, mirror := range mirrors {
+		link.BaseURL = mirror.BaseURL
+		url, err := ExecuteLinkTemplate(mirror.linkTemplate(dataSet), &link)
+		if err != nil {
+			return nil, fmt.Errorf("mirror %s: %w", mirror.Name, err)
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+// PiecePath 返回piece相对下载源根目录的路径，即最近的下载源的链接模板去掉 BaseURL 后的部分
+func (m *Mirrors) PiecePath(dataSet *DataSet, piece *Piece, link LinkData, region string) (string, error) {
+	link.setPiece(dataSet, piece)
+	mirrors, err := m.available(dataSet, piece, region)
+	if err != nil {
+		return "", err
+	}
+	text := dataSet.LinkTemplate
+	if len(mirrors) > 0 {
+		text = mirrors[0].linkTemplate(dataSet)
+	}
+	return LinkPath(text, &link)
+}
+
+// available 返回可用的下载源，配置了下载源但都不可用时返回错误
+func (m *Mirrors) available(dataSet *DataSet, piece *Piece, region string) ([]*Mirror, error) {
+	mirrors := m.Select(dataSet, piece, region)
+	if names := mirrorNames(dataSet, piece); len(mirrors) == 0 && len(names) > 0 {
+		return nil, fmt.Errorf("all mirrors of piece %s are down or removed: %s", piece.PieceCid, strings.Join(names, ", "))
+	}
+	return mirrors, nil
+}
+
+// linkTemplate 下载源的链接模板，为空时使用数据集的
+func (m *Mirror) linkTemplate(dataSet *DataSet) string {
+	if m.Template != "" {
+		return m.Template
+	}
+	return dataSet.LinkTemplate
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/liushuochen/gotable"
+	"github.com/urfave/cli/v2"
+)
+
+// 按org分配时计算每个sp分到多少size的方式
+const (
+	SplitEven     = "even"
+	SplitWeight   = "weight"
+	SplitCapacity = "capacity"
+)
+
+// OrgShare org内一个sp在按org分配时的比重
+type OrgShare struct {
+	Sp     string
+	Weight float64
+}
+
+// OrgShares 返回org内可以分配的sp及其比重，跳过暂停或禁止的sp，跳过的原因写到 warn。
+// weight 使用sp的 Weight(没有设置时为1)，capacity 使用sp的 MaxDailyIngest，没有设置的sp不参与分配
+func OrgShares(user *User, split string, warn io.Writer) ([]*OrgShare, error) {
+	var shares []*OrgShare
+	for _, p := range user.Providers {
+		if err := p.CanAllocate(); err != nil {
+			fmt.Fprintf(warn, "skip %v\n", err)
+			continue
+		}
+		share := &OrgShare{Sp: p.Sp, Weight: 1}
+		switch split {
+		case SplitEven:
+		case SplitWeight:
+			if p.Weight > 0 {
+				share.Weight = p.Weight
+			}
+		case SplitCapacity:
+			if p.MaxDailyIngest <= 0 {
+				fmt.Fprintf(warn, "skip sp %s: no max daily ingest\n", p.Sp)
+				continue
+			}
+			share.Weight = p.MaxDailyIngest
+		default:
+			return nil, fmt.Errorf("unknown split %s, must be one of %s, %s, %s", split, SplitEven, SplitWeight, SplitCapacity)
+		}
+		shares = append(shares, share)
+	}
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("org %s has no sp to allocate", user.Org)
+	}
+	return shares, nil
+}
+
+// orgAllocation 按org分配时一个sp的分配结果
+type orgAllocation struct {
+	share *OrgShare
+	// 按比重分到的size(bytes)
+	size   int64
+	alloc  *Allocation
+	pieces []*Piece
+}
+
+// datasetGetOrg 把 params.Size 按比重分给org内的sp，前面的sp没有分配满时剩余的部分由后面的sp分担。
+// 每个sp一次分配，ExcludeOrgMates 保证同一个piece不会分配给同一org的两个sp，即使设置了 Repeat。
+// 跳过的sp和分配的警告写到 warn
+func datasetGetOrg(ctx *cli.Context, repo, before *Repo, target *DataSet, params *AllocParams, warn io.Writer) error {
+	org := ctx.String("org")
+	user := repo.Users.Get(org)
+	if user == nil {
+		return fmt.Errorf("org %s not found", org)
+	}
+	shares, err := OrgShares(user, ctx.String("split"), warn)
+	if err != nil {
+		return err
+	}
+	var weights float64
+	for _, share := range shares {
+		weights += share.Weight
+	}
+
+	var allocs []*orgAllocation
+	var lastErr error
+	remaining := params.Size
+	for _, share := range shares {
+		size := int64(float64(remaining) * share.Weight / weights)
+		weights -= share.Weight
+		if size <= 0 {
+			continue
+		}
+		spParams := *params
+		spParams.Sp, spParams.Size = share.Sp, size
+		spParams.ExcludeOrgMates = true
+		alloc, result, err := allocate(ctx, repo, &spParams, warn)
+		if err != nil {
+			fmt.Fprintf(warn, "skip sp %s: %v\n", share.Sp, err)
+			lastErr = err
+			continue
+		}
+		remaining -= result.PieceSize
+		allocs = append(allocs, &orgAllocation{share: share, size: size, alloc: alloc, pieces: result.Pieces})
+	}
+	if len(allocs) == 0 && lastErr != nil {
+		return lastErr
+	}
+
+	if ctx.Bool("dry-run") {
+		_, err = commitRepo(ctx, before, repo)
+		return err
+	}
+
+	output := ctx.String("output")
+	table, err := gotable.Create("sp", "weight", "pieces", "pieceSize(TiB)", "missing(TiB)", "allocationId", "file")
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, a := range allocs {
+		var file string
+		if len(a.pieces) > 0 {
+			file = filepath.Join(ctx.String("out-dir"), fmt.Sprintf("%s-%s.%s", target.DataSetName, a.share.Sp, outputExt(output)))
+		}
+		files = append(files, file)
+		table.AddRow([]string{a.share.Sp, strconv.FormatFloat(a.share.Weight, 'f', -1, 64), strconv.Itoa(len(a.pieces)), strconv.FormatFloat(float64(a.alloc.PieceSize)/(1<<40), 'f', -1, 64), strconv.FormatFloat(float64(a.size-a.alloc.PieceSize)/(1<<40), 'f', -1, 64), strconv.FormatInt(a.alloc.ID, 10), file})
+	}
+	fmt.Println(table)
+	fmt.Printf("total pieceSize:%v, missing pieceSize:%v\n", float64(params.Size-remaining)/(1<<40), float64(remaining)/(1<<40))
+
+	if !ctx.Bool("really-do-it") {
+		return fmt.Errorf("--really-do-it must be specified for this action to have an effect; you have been warned")
+	}
+	for i, a := range allocs {
+		if files[i] == "" {
+			continue
+		}
+		out, err := allocOutput(ctx, repo, target, a.alloc, a.pieces)
+		if err != nil {
+			return err
+		}
+		out.Summary.MissingPieceSize = a.size - a.alloc.PieceSize
+		f, err := os.Create(files[i])
+		if err != nil {
+			return err
+		}
+		err = WriteOutput(f, output, out)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if ok, err := commitRepo(ctx, before, repo); err != nil || !ok {
+		return err
+	}
+	for _, a := range allocs {
+		if a.alloc.ID > 0 {
+			fmt.Fprintf(warn, "allocation %d recorded for %s\n", a.alloc.ID, a.share.Sp)
+		}
+	}
+	return nil
+}
+
+// outputExt 按org分配时输出文件的扩展名
+func outputExt(format string) string {
+	switch format {
+	case "url":
+		return "txt"
+	case "boost":
+		return "sh"
+	}
+	return format
+}
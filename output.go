@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// mainnet 创世区块时间，每个高度30秒
+const (
+	genesisTimestamp = 1598306400
+	epochDuration    = 30
+	epochsPerDay     = 24 * 60 * 60 / epochDuration
+)
+
+// OutputItem 分配结果中的一个piece
+type OutputItem struct {
+	DataSetName  string
+	Sp           string
+	Client       string
+	AllocationID int64
+	Piece        *Piece
+	// 下载链接，按优先级排序
+	URLs []string
+	// 相对下载源根目录的路径
+	Path string
+}
+
+// URL 返回优先级最高的下载链接
+func (i *OutputItem) URL() string {
+	if len(i.URLs) == 0 {
+		return ""
+	}
+	return i.URLs[0]
+}
+
+// FileName 返回下载后保存的文件名。链接模板生成的链接不一定以文件名结尾，取不到时使用 pieceCid.car
+func (i *OutputItem) FileName() string {
+	name := carFileName(i.URL())
+	if !strings.Contains(name, i.Piece.PieceCid) {
+		name = i.Piece.PieceCid + ".car"
+	}
+	return name
+}
+
+// DealParams boost 发单需要的参数
+type DealParams struct {
+	Verified   bool
+	StartEpoch int64
+	Duration   int64
+	Wallet     string
+}
+
+// OutputSummary 分配结果的汇总
+type OutputSummary struct {
+	Pieces int `json:"pieces"`
+	// 本次分配的总pieceSize和carSize(bytes)
+	PieceSize int64 `json:"pieceSize"`
+	CarSize   int64 `json:"carSize"`
+	// 请求的size中没能分配的部分(bytes)
+	MissingPieceSize int64 `json:"missingPieceSize"`
+	AllocationID     int64 `json:"allocationId,omitempty"`
+}
+
+// Output 一次分配需要输出的全部内容
+type Output struct {
+	Items   []*OutputItem
+	Deal    *DealParams
+	Summary *OutputSummary
+}
+
+type outputWriter func(w io.Writer, out *Output) error
+
+var outputWriters = map[string]outputWriter{
+	"url":        writeUrls,
+	"boost":      writeBoostScript,
+	"boost-json": writeBoostJson,
+	"aria2":      writeAria2,
+	"wget":       writeWget,
+	"curl":       writeCurl,
+	"rclone":     writeRcloneFilter,
+	"json":       writeJson,
+	"ndjson":     writeNdjson,
+}
+
+func outputFormats() string {
+	var names []string
+	for name := range outputWriters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// WriteOutput 按 format 输出分配结果
+func WriteOutput(w io.Writer, format string, out *Output) error {
+	writer, ok := outputWriters[format]
+	if !ok {
+		return fmt.Errorf("unknown output format %s, must be one of %s", format, outputFormats())
+	}
+	return writer(w, out)
+}
+
+// WriteSummary 输出汇总信息。url 格式保持原来的输出写到 stdout，json 格式已经包含汇总，其他格式写到 stderr 以免影响下载工具读取
+func WriteSummary(stdout, stderr io.Writer, format string, summary *OutputSummary) error {
+	if summary == nil || format == "json" {
+		return nil
+	}
+	w := stderr
+	if format == "url" {
+		w = stdout
+	}
+	_, err := fmt.Fprintf(w, "total pieceSize:%v, total carSize: %v, missing pieceSize:%v\n", float64(summary.PieceSize)/(1<<40), float64(summary.CarSize)/(1<<40), float64(summary.MissingPieceSize)/(1<<40))
+	return err
+}
+
+func writeUrls(w io.Writer, out *Output) error {
+	for _, item := range out.Items {
+		if _, err := fmt.Fprintln(w, strings.Join(item.URLs, "\t")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// currentEpoch 根据当前时间估算链高度
+func currentEpoch(now time.Time) int64 {
+	return (now.Unix() - genesisTimestamp) / epochDuration
+}
+
+// paddedPieceSize 返回不小于 size 的2的幂
+func paddedPieceSize(size int64) int64 {
+	padded := int64(1)
+	for padded < size {
+		padded <<= 1
+	}
+	return padded
+}
+
+// BoostDeal 一个piece的 boost offline-deal 参数
+type BoostDeal struct {
+	Provider     string `json:"provider"`
+	PieceCid     string `json:"pieceCid"`
+	PieceSize    int64  `json:"pieceSize"`
+	PayloadCid   string `json:"payloadCid"`
+	CarSize      int64  `json:"carSize"`
+	Client       string `json:"client"`
+	Verified     bool   `json:"verified"`
+	StartEpoch   int64  `json:"startEpoch"`
+	Duration     int64  `json:"duration"`
+	AllocationID int64  `json:"allocationId,omitempty"`
+	URL          string `json:"url,omitempty"`
+	FileName     string `json:"fileName,omitempty"`
+}
+
+func boostDeals(items []*OutputItem, deal *DealParams) ([]*BoostDeal, error) {
+	var deals []*BoostDeal
+	for _, item := range items {
+		client := deal.Wallet
+		if client == "" {
+			client = item.Client
+		}
+		if client == "" {
+			return nil, fmt.Errorf("dataset %s has no client address, please add a client or specify --wallet", item.DataSetName)
+		}
+		if item.Piece.DataCid == "" {
+			return nil, fmt.Errorf("piece %s has no dataCid", item.Piece.PieceCid)
+		}
+		deals = append(deals, &BoostDeal{
+			Provider:     item.Sp,
+			PieceCid:     item.Piece.PieceCid,
+			PieceSize:    paddedPieceSize(item.Piece.PieceSize),
+			PayloadCid:   item.Piece.DataCid,
+			CarSize:      item.Piece.CarSize,
+			Client:       client,
+			Verified:     deal.Verified,
+			StartEpoch:   deal.StartEpoch,
+			Duration:     deal.Duration,
+			AllocationID: item.AllocationID,
+			URL:          item.URL(),
+			FileName:     item.FileName(),
+		})
+	}
+	return deals, nil
+}
+
+func writeBoostScript(w io.Writer, out *Output) error {
+	deals, err := boostDeals(out.Items, out.Deal)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprint(w, "#!/usr/bin/env bash\nset -euo pipefail\n\n"); err != nil {
+		return err
+	}
+	for _, d := range deals {
+		_, err := fmt.Fprintf(w, "boost offline-deal --provider=%s --commp=%s --piece-size=%d --car-size=%d --payload-cid=%s --wallet=%s --verified=%v --start-epoch=%d --duration=%d --storage-price=0\n",
+			shellQuote(d.Provider), shellQuote(d.PieceCid), d.PieceSize, d.CarSize, shellQuote(d.PayloadCid), shellQuote(d.Client), d.Verified, d.StartEpoch, d.Duration)
+		if err != nil {
+			return err
+		}
+		if d.URL != "" {
+			// sp 收到数据后用 offline-deal 返回的 deal uuid 导入
+			if _, err := fmt.Fprintf(w, "# boostd import-data <deal-uuid> %s\n", shellQuote(d.FileName)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeBoostJson(w io.Writer, out *Output) error {
+	deals, err := boostDeals(out.Items, out.Deal)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, d := range deals {
+		if err := enc.Encode(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// carFileName 取下载链接的文件名
+func carFileName(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		url = url[:i]
+	}
+	return url[strings.LastIndex(url, "/")+1:]
+}
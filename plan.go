@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/gh-efforts/distribution/distribution"
+	"github.com/urfave/cli/v2"
+)
+
+// AllocParams 一次分配的全部输入，保存在分配计划中，用于复现分配结果
+type AllocParams struct {
+	DataSetName string `json:"dataSetName"`
+	Sp          string `json:"sp"`
+	// 需要的pieceSize(bytes)
+	Size      int64  `json:"size"`
+	Duplicate int    `json:"duplicate,omitempty"`
+	Repeat    int    `json:"repeat,omitempty"`
+	Fit       string `json:"fit"`
+	Strategy  string `json:"strategy"`
+	Seed      int64  `json:"seed"`
+	// 只分配有这些标签的piece
+	Tags []string `json:"tags,omitempty"`
+	// 为空时使用剩余预算最多的client
+	Client        string `json:"client,omitempty"`
+	CheckChain    bool   `json:"checkChain,omitempty"`
+	OverrideQuota bool   `json:"overrideQuota,omitempty"`
+	// 按org分配时组织内的sp不能持有同一个piece
+	ExcludeOrgMates bool `json:"excludeOrgMates,omitempty"`
+}
+
+// Plan 分配计划。只有仓库状态与生成计划时相同才能应用，保证应用的结果与计划一致
+type Plan struct {
+	Time     time.Time `json:"time"`
+	Operator string    `json:"operator"`
+	// 生成计划时仓库状态的sha256
+	StateHash string       `json:"stateHash"`
+	Params    *AllocParams `json:"params"`
+	Org       string       `json:"org"`
+	Client    string       `json:"client,omitempty"`
+	Pieces    []string     `json:"pieces"`
+	PieceSize int64        `json:"pieceSize"`
+	CarSize   int64        `json:"carSize"`
+}
+
+// StateHash 返回仓库全部数据的sha256
+func (r *Repo) StateHash() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// prepareAllocParams 按仓库配置检查不是从命令行传入的分配参数，并补全默认的 fit、strategy 和 seed
+func prepareAllocParams(repo *Repo, params *AllocParams) error {
+	if maxSize := repoConfig.Policy.MaxSizePerGet; maxSize > 0 && float64(params.Size)/(1<<40) > maxSize {
+		return fmt.Errorf("size %vTiB exceeds the max size per get %vTiB in the repo config", float64(params.Size)/(1<<40), maxSize)
+	}
+	if params.OverrideQuota && !repoConfig.Policy.AllowOverrideQuota {
+		return fmt.Errorf("override quota is not allowed by the repo config")
+	}
+	if params.Fit == "" {
+		params.Fit = repoConfig.Defaults.Fit
+	}
+	if target := repo.DataSets.GetDataset(params.DataSetName); target != nil && params.Strategy == "" {
+		params.Strategy = target.Strategy
+	}
+	if params.Strategy == distribution.StrategyRandom && params.Seed == 0 {
+		params.Seed = time.Now().UnixNano()
+	}
+	return nil
+}
+
+// allocate 按 params 在 repo 中分配piece给sp，扣减client的DataCap，并添加分配记录(没有分配到piece时不添加)，配额和DataCap的警告写到 warn
+func allocate(ctx *cli.Context, repo *Repo, params *AllocParams, warn io.Writer) (*Allocation, *distribution.AllocateResult, error) {
+	user := repo.Users.GetBySp(params.Sp)
+	if user == nil {
+		return nil, nil, fmt.Errorf("%s does not belong to any organization, please add user sp first", params.Sp)
+	}
+	if p := user.Provider(params.Sp); p != nil {
+		if err := p.CanAllocate(); err != nil {
+			return nil, nil, err
+		}
+	}
+	target := repo.DataSets.GetDataset(params.DataSetName)
+	if target == nil {
+		return nil, nil, fmt.Errorf("dataset %s not found", params.DataSetName)
+	}
+
+	limit := &QuotaLimit{Limit: -1}
+	if !params.OverrideQuota {
+		limit = CheckQuota(user, params.Sp, target, repo.Allocations, time.Now())
+		if limit.Limit == 0 {
+			return nil, nil, fmt.Errorf("%s has no quota left: %s. use --override-quota to ignore it", params.Sp, limit.Reason)
+		}
+	}
+
+	client, err := target.PickClient(params.Client)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client != nil {
+		limit.apply(client.Remaining(), fmt.Sprintf("client %s DataCap budget %vTiB, used %vTiB", client.Address, float64(client.DataCap)/(1<<40), float64(client.Used)/(1<<40)))
+		if params.CheckChain {
+			onChain, err := checkOnChainDataCap(ctx, client.Address)
+			if err != nil {
+				return nil, nil, err
+			}
+			limit.apply(onChain, fmt.Sprintf("client %s on-chain DataCap %vTiB", client.Address, float64(onChain)/(1<<40)))
+		}
+		if limit.Limit == 0 {
+			return nil, nil, fmt.Errorf("no DataCap left for dataset %s: %s", params.DataSetName, limit.Reason)
+		}
+	}
+	if limit.Limit > 0 && limit.Limit < params.Size {
+		fmt.Fprintf(warn, "the size is limited to %vTiB: %s\n", float64(limit.Limit)/(1<<40), limit.Reason)
+	}
+
+	strategy, err := distribution.NewStrategy(params.Strategy, params.Seed)
+	if err != nil {
+		return nil, nil, err
+	}
+	req := &distribution.AllocateRequest{
+		Sp:        params.Sp,
+		OrgSps:    user.Sps(),
+		Size:      params.Size,
+		Duplicate: params.Duplicate,
+		Repeat:    params.Repeat,
+		Fit:       distribution.Fit(params.Fit),
+		Strategy:  strategy,
+		Tags:      params.Tags,
+	}
+	if limit.Limit > 0 {
+		req.Limit = limit.Limit
+	}
+	req.ExcludeOrgMates = params.ExcludeOrgMates
+	result, err := distribution.Allocate(target, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if client != nil {
+		client.Used += result.PieceSize
+		if warning := DataCapWarning(client, ctx.Float64("warn-below")); warning != "" {
+			fmt.Fprintf(warn, "warning: %s\n", warning)
+		}
+	}
+
+	alloc := &Allocation{
+		Time:        time.Now(),
+		DataSetName: params.DataSetName,
+		Org:         user.Org,
+		Sp:          params.Sp,
+		PieceSize:   result.PieceSize,
+		CarSize:     result.CarSize,
+		Override:    params.OverrideQuota,
+	}
+	if client != nil {
+		alloc.Client = client.Address
+	}
+	for _, piece := range result.Pieces {
+		alloc.Pieces = append(alloc.Pieces, piece.PieceCid)
+	}
+	if len(alloc.Pieces) > 0 {
+		repo.Allocations.Add(alloc)
+	}
+	return alloc, result, nil
+}
+
+// NewPlan 用分配前的仓库状态和分配结果生成分配计划
+func NewPlan(before *Repo, params *AllocParams, alloc *Allocation) (*Plan, error) {
+	stateHash, err := before.StateHash()
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{
+		Time:      time.Now(),
+		Operator:  operator,
+		StateHash: stateHash,
+		Params:    params,
+		Org:       alloc.Org,
+		Client:    alloc.Client,
+		Pieces:    alloc.Pieces,
+		PieceSize: alloc.PieceSize,
+		CarSize:   alloc.CarSize,
+	}, nil
+}
+
+func WritePlan(file string, plan *Plan) error {
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+func ReadPlan(file string) (*Plan, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	plan := new(Plan)
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("read plan %s: %w", file, err)
+	}
+	if plan.Params == nil {
+		return nil, fmt.Errorf("read plan %s: missing params", file)
+	}
+	return plan, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+// sp 状态，只有 onboarding 和 active 的sp可以分配
+const (
+	SpOnboarding = "onboarding"
+	SpActive     = "active"
+	SpPaused     = "paused"
+	SpBanned     = "banned"
+)
+
+// ValidSpStatus status 是否为合法的sp状态
+func ValidSpStatus(status string) bool {
+	switch status {
+	case SpOnboarding, SpActive, SpPaused, SpBanned:
+		return true
+	}
+	return false
+}
+
+// Provider 组织内单个sp的属性
+type Provider struct {
+	Sp    string `json:"sp"`
+	Quota *Quota `json:"quota,omitempty"`
+	// 所在区域，用于选择最近的下载源
+	Region   string `json:"region,omitempty"`
+	Location string `json:"location,omitempty"`
+	Contact  string `json:"contact,omitempty"`
+	// 扇区大小(bytes)
+	SectorSize int64 `json:"sectorSize,omitempty"`
+	// 每24小时最多能接收的pieceSize(TiB)，0表示不限制
+	MaxDailyIngest    float64 `json:"maxDailyIngest,omitempty"`
+	RetrievalEndpoint string  `json:"retrievalEndpoint,omitempty"`
+	// dataset get --org 按比重分配时使用，0表示1
+	Weight float64 `json:"weight,omitempty"`
+	// 为空表示 active
+	Status       string `json:"status,omitempty"`
+	StatusReason string `json:"statusReason,omitempty"`
+}
+
+// GetStatus 返回sp状态，没有设置时为 active
+func (p *Provider) GetStatus() string {
+	if p == nil || p.Status == "" {
+		return SpActive
+	}
+	return p.Status
+}
+
+// CanAllocate 暂停或者禁止的sp不能分配
+func (p *Provider) CanAllocate() error {
+	switch status := p.GetStatus(); status {
+	case SpPaused, SpBanned:
+		if p.StatusReason != "" {
+			return fmt.Errorf("sp %s is %s: %s", p.Sp, status, p.StatusReason)
+		}
+		return fmt.Errorf("sp %s is %s", p.Sp, status)
+	}
+	return nil
+}
+
+// Provider 返回sp的属性，sp不在组织中时返回nil
+func (u *User) Provider(sp string) *Provider {
+	for _, p := range u.Providers {
+		if p.Sp == sp {
+			return p
+		}
+	}
+	return nil
+}
+
+// Region 返回sp所在区域，没有记录时返回空
+func (u *User) Region(sp string) string {
+	if p := u.Provider(sp); p != nil {
+		return p.Region
+	}
+	return ""
+}
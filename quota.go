@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Quota 分配额度限制，字段为0表示不限制
+type Quota struct {
+	// 每24小时最多分配的pieceSize(TiB)
+	MaxTiBPerDay float64 `json:"maxTiBPerDay,omitempty" toml:"max_tib_per_day"`
+	// 每7天最多分配的pieceSize(TiB)
+	MaxTiBPerWeek float64 `json:"maxTiBPerWeek,omitempty" toml:"max_tib_per_week"`
+	// 单个数据集中最多持有的pieceSize比例，0-1
+	MaxDataSetShare float64 `json:"maxDataSetShare,omitempty" toml:"max_share"`
+	// 最多未确认的分配数量
+	MaxOutstanding int `json:"maxOutstanding,omitempty" toml:"max_outstanding"`
+}
+
+func (q *Quota) IsZero() bool {
+	return q == nil || *q == Quota{}
+}
+
+func (q *Quota) String() string {
+	if q.IsZero() {
+		return ""
+	}
+	var parts []string
+	if q.MaxTiBPerDay > 0 {
+		parts = append(parts, fmt.Sprintf("day=%vTiB", q.MaxTiBPerDay))
+	}
+	if q.MaxTiBPerWeek > 0 {
+		parts = append(parts, fmt.Sprintf("week=%vTiB", q.MaxTiBPerWeek))
+	}
+	if q.MaxDataSetShare > 0 {
+		parts = append(parts, fmt.Sprintf("share=%v", q.MaxDataSetShare))
+	}
+	if q.MaxOutstanding > 0 {
+		parts = append(parts, fmt.Sprintf("outstanding=%d", q.MaxOutstanding))
+	}
+	return strings.Join(parts, " ")
+}
+
+// QuotaLimit 根据配额计算出的剩余可分配pieceSize
+type QuotaLimit struct {
+	// 小于0表示不限制
+	Limit int64
+	// 起限制作用的配额
+	Reason string
+}
+
+func (l *QuotaLimit) apply(remaining int64, reason string) {
+	if remaining < 0 {
+		remaining = 0
+	}
+	if l.Limit < 0 || remaining < l.Limit {
+		l.Limit = remaining
+		l.Reason = reason
+	}
+}
+
+// CheckQuota 计算sp在数据集中还能分配多少pieceSize，同时检查sp和所在org的配额
+func CheckQuota(user *User, sp string, dataSet *DataSet, allocs *Allocations, now time.Time) *QuotaLimit {
+	limit := &QuotaLimit{Limit: -1}
+	if user == nil {
+		return limit
+	}
+	if p := user.Provider(sp); p != nil {
+		limit.check(p.Quota, "sp "+sp, []string{sp}, dataSet, allocs, now)
+		if p.MaxDailyIngest > 0 {
+			used := allocs.SizeSince([]string{sp}, now.Add(-24*time.Hour))
+			limit.apply(int64(p.MaxDailyIngest*(1<<40))-used, fmt.Sprintf("sp %s max daily ingest %vTiB, used %vTiB", sp, p.MaxDailyIngest, float64(used)/(1<<40)))
+		}
+	}
+	quota := user.Quota
+	if quota.IsZero() {
+		quota = &repoConfig.Quota
+	}
+	limit.check(quota, "org "+user.Org, user.Sps(), dataSet, allocs, now)
+	return limit
+}
+
+func (l *QuotaLimit) check(q *Quota, owner string, sps []string, dataSet *DataSet, allocs *Allocations, now time.Time) {
+	if q.IsZero() {
+		return
+	}
+	if q.MaxTiBPerDay > 0 {
+		used := allocs.SizeSince(sps, now.Add(-24*time.Hour))
+		l.apply(int64(q.MaxTiBPerDay*(1<<40))-used, fmt.Sprintf("%s daily quota %vTiB, used %vTiB", owner, q.MaxTiBPerDay, float64(used)/(1<<40)))
+	}
+	if q.MaxTiBPerWeek > 0 {
+		used := allocs.SizeSince(sps, now.AddDate(0, 0, -7))
+		l.apply(int64(q.MaxTiBPerWeek*(1<<40))-used, fmt.Sprintf("%s weekly quota %vTiB, used %vTiB", owner, q.MaxTiBPerWeek, float64(used)/(1<<40)))
+	}
+	if q.MaxDataSetShare > 0 && dataSet != nil {
+		var total, held int64
+		for _, piece := range dataSet.Pieces {
+			total += piece.PieceSize
+			for _, spInfo := range piece.SpInfos {
+				if !spInfo.Lost && containsString(sps, spInfo.Sp) {
+					held += piece.PieceSize
+					break
+				}
+			}
+		}
+		if total > 0 {
+			l.apply(int64(q.MaxDataSetShare*float64(total))-held, fmt.Sprintf("%s dataset share quota %v, holding %v", owner, q.MaxDataSetShare, float64(held)/float64(total)))
+		}
+	}
+	if q.MaxOutstanding > 0 {
+		if n := allocs.Outstanding(sps); n >= q.MaxOutstanding {
+			l.apply(0, fmt.Sprintf("%s has %d unconfirmed allocations, max %d", owner, n, q.MaxOutstanding))
+		}
+	}
+}
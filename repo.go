@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Repo 仓库中全部可修改的数据
+type Repo struct {
+	Users       *Users
+	DataSets    *DataSets
+	Allocations *Allocations
+	Mirrors     *Mirrors
+}
+
+func NewRepo() *Repo {
+	return &Repo{Users: NewUsers(), DataSets: NewDataSets(), Allocations: NewAllocations(), Mirrors: NewMirrors()}
+}
+
+// LoadRepo 从仓库目录读取全部数据
+func LoadRepo() (*Repo, error) {
+	users := NewUsers()
+	if err := users.ReadUsersFromFile(); err != nil {
+		return nil, err
+	}
+	dataSets := NewDataSets()
+	if err := dataSets.ReadDataSetsFromFile(); err != nil {
+		return nil, err
+	}
+	allocs := NewAllocations()
+	if err := allocs.ReadAllocationsFromFile(); err != nil {
+		return nil, err
+	}
+	mirrors := NewMirrors()
+	if err := mirrors.ReadMirrorsFromFile(); err != nil {
+		return nil, err
+	}
+	return &Repo{Users: users, DataSets: dataSets, Allocations: allocs, Mirrors: mirrors}, nil
+}
+
+// Clone 深拷贝一份仓库数据，用于在内存中计算修改后的状态
+func (r *Repo) Clone() (*Repo, error) {
+	out := NewRepo()
+	if err := cloneJson(r.Users, out.Users); err != nil {
+		return nil, err
+	}
+	if err := cloneJson(r.DataSets, out.DataSets); err != nil {
+		return nil, err
+	}
+	if err := cloneJson(r.Allocations, out.Allocations); err != nil {
+		return nil, err
+	}
+	if err := cloneJson(r.Mirrors, out.Mirrors); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Save 只写入相对 before 有变化的文件
+func (r *Repo) Save(before *Repo) error {
+	if before == nil || !jsonEqual(before.Users, r.Users) {
+		if err := r.Users.WriteUsersToFile(); err != nil {
+			return err
+		}
+	}
+	if before == nil || !jsonEqual(before.DataSets, r.DataSets) {
+		if err := r.DataSets.WriteDataSetsToFile(); err != nil {
+			return err
+		}
+	}
+	if before == nil || !jsonEqual(before.Allocations, r.Allocations) {
+		if err := r.Allocations.WriteAllocationsToFile(); err != nil {
+			return err
+		}
+	}
+	if before == nil || !jsonEqual(before.Mirrors, r.Mirrors) {
+		if err := r.Mirrors.WriteMirrorsToFile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func cloneJson(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+func jsonEqual(a, b interface{}) bool {
+	da, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	db, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(da, db)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// rosterColumns 名单csv的列，与 RosterEntry 的json字段相同
+var rosterColumns = []string{"org", "sp", "status", "region", "location", "contact", "sectorSizeGiB", "maxDailyIngest", "weight", "retrieval"}
+
+// RosterEntry 名单中的一个sp。导入时为空的属性保持不变，因此名单不能清空属性，需要使用 sp set；配额不在名单中
+type RosterEntry struct {
+	Org           string `json:"org"`
+	Sp            string `json:"sp"`
+	Status        string `json:"status,omitempty"`
+	Region        string `json:"region,omitempty"`
+	Location      string `json:"location,omitempty"`
+	Contact       string `json:"contact,omitempty"`
+	SectorSizeGiB int64  `json:"sectorSizeGiB,omitempty"`
+	// TiB
+	MaxDailyIngest float64 `json:"maxDailyIngest,omitempty"`
+	Weight         float64 `json:"weight,omitempty"`
+	Retrieval      string  `json:"retrieval,omitempty"`
+}
+
+// RosterChanges 导入名单对 Users 的修改
+type RosterChanges struct {
+	Orgs       []string            `json:"orgs,omitempty"`
+	Membership []*MembershipChange `json:"membership,omitempty"`
+	// 属性有变化的sp
+	Updated []string `json:"updated,omitempty"`
+}
+
+func (c *RosterChanges) IsEmpty() bool {
+	return len(c.Orgs) == 0 && len(c.Membership) == 0 && len(c.Updated) == 0
+}
+
+// ExportRoster 按 Users 中的顺序导出全部sp
+func ExportRoster(users *Users) []*RosterEntry {
+	var roster []*RosterEntry
+	for _, user := range users.List {
+		for _, p := range user.Providers {
+			roster = append(roster, &RosterEntry{
+				Org:            user.Org,
+				Sp:             p.Sp,
+				Status:         p.Status,
+				Region:         p.Region,
+				Location:       p.Location,
+				Contact:        p.Contact,
+				SectorSizeGiB:  p.SectorSize >> 30,
+				MaxDailyIngest: p.MaxDailyIngest,
+				Weight:         p.Weight,
+				Retrieval:      p.RetrievalEndpoint,
+			})
+		}
+	}
+	return roster
+}
+
+// ApplyRoster 按名单新建org、加入或移动sp并更新属性，prune 为 true 时移除不在名单中的sp
+func ApplyRoster(users *Users, roster []*RosterEntry, prune bool) (*RosterChanges, error) {
+	changes := new(RosterChanges)
+	listed := make(map[string]bool)
+	for i, entry := range roster {
+		if entry == nil {
+			return nil, fmt.Errorf("roster entry %d is null", i+1)
+		}
+		if entry.Org == "" || entry.Sp == "" {
+			return nil, fmt.Errorf("roster entry %+v: org and sp are required", *entry)
+		}
+		if listed[entry.Sp] {
+			return nil, fmt.Errorf("%s is listed more than once in the roster", entry.Sp)
+		}
+		listed[entry.Sp] = true
+		if entry.Status != "" && !ValidSpStatus(entry.Status) {
+			return nil, fmt.Errorf("%s: unknown sp status %s", entry.Sp, entry.Status)
+		}
+
+		user := users.Get(entry.Org)
+		if user == nil {
+			user = &User{Org: entry.Org}
+			users.Add(user)
+			changes.Orgs = append(changes.Orgs, entry.Org)
+		}
+		var change *MembershipChange
+		var err error
+		if owner := users.GetBySp(entry.Sp); owner != nil && owner.Org != entry.Org {
+			change, err = users.MoveSp(owner.Org, entry.Org, entry.Sp)
+		} else {
+			change, err = users.AddSp(entry.Org, entry.Sp)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if change != nil {
+			changes.Membership = append(changes.Membership, change)
+		}
+		if entry.applyTo(user) {
+			changes.Updated = append(changes.Updated, entry.Sp)
+		}
+	}
+
+	if prune {
+		for _, user := range users.List {
+			for _, sp := range user.Sps() {
+				if listed[sp] {
+					continue
+				}
+				change, err := users.RemoveSp(user.Org, sp)
+				if err != nil {
+					return nil, err
+				}
+				changes.Membership = append(changes.Membership, change)
+			}
+		}
+	}
+	return changes, users.Validate()
+}
+
+// applyTo 把名单中不为空的属性写入sp，为空的属性不清空，返回属性是否有变化
+func (e *RosterEntry) applyTo(user *User) bool {
+	if e.Status == "" && e.Region == "" && e.Location == "" && e.Contact == "" && e.SectorSizeGiB == 0 && e.MaxDailyIngest == 0 && e.Weight == 0 && e.Retrieval == "" {
+		return false
+	}
+	p := user.Provider(e.Sp)
+	old := *p
+	if e.Status != "" {
+		p.Status = e.Status
+	}
+	if e.Region != "" {
+		p.Region = e.Region
+	}
+	if e.Location != "" {
+		p.Location = e.Location
+	}
+	if e.Contact != "" {
+		p.Contact = e.Contact
+	}
+	if e.SectorSizeGiB != 0 {
+		p.SectorSize = e.SectorSizeGiB << 30
+	}
+	if e.MaxDailyIngest != 0 {
+		p.MaxDailyIngest = e.MaxDailyIngest
+	}
+	if e.Weight != 0 {
+		p.Weight = e.Weight
+	}
+	if e.Retrieval != "" {
+		p.RetrievalEndpoint = e.Retrieval
+	}
+	return !jsonEqual(&old, p)
+}
+
+// ReadRoster 读取csv或json格式的名单，csv第一行为列名，org 和 sp 必须有，其他列可以省略
+func ReadRoster(r io.Reader, format string) ([]*RosterEntry, error) {
+	switch format {
+	case "json":
+		var roster []*RosterEntry
+		if err := json.NewDecoder(r).Decode(&roster); err != nil {
+			return nil, fmt.Errorf("read roster: %w", err)
+		}
+		return roster, nil
+	case "csv":
+	default:
+		return nil, fmt.Errorf("unknown roster format %s, must be csv or json", format)
+	}
+
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read roster: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		name = strings.TrimSpace(name)
+		if !containsString(rosterColumns, name) {
+			return nil, fmt.Errorf("read roster: unknown column %s, must be one of %s", name, strings.Join(rosterColumns, ", "))
+		}
+		columns[name] = i
+	}
+	for _, name := range []string{"org", "sp"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("read roster: missing column %s", name)
+		}
+	}
+
+	var roster []*RosterEntry
+	for n, record := range records[1:] {
+		get := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		entry := &RosterEntry{
+			Org:       get("org"),
+			Sp:        get("sp"),
+			Status:    get("status"),
+			Region:    get("region"),
+			Location:  get("location"),
+			Contact:   get("contact"),
+			Retrieval: get("retrieval"),
+		}
+		if v := get("sectorSizeGiB"); v != "" {
+			if entry.SectorSizeGiB, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("read roster line %d: sectorSizeGiB: %w", n+2, err)
+			}
+		}
+		if v := get("maxDailyIngest"); v != "" {
+			if entry.MaxDailyIngest, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("read roster line %d: maxDailyIngest: %w", n+2, err)
+			}
+		}
+		if v := get("weight"); v != "" {
+			if entry.Weight, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil, fmt.Errorf("read roster line %d: weight: %w", n+2, err)
+			}
+		}
+		roster = append(roster, entry)
+	}
+	return roster, nil
+}
+
+// WriteRoster 以csv或json格式输出名单
+func WriteRoster(w io.Writer, format string, roster []*RosterEntry) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(roster, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+	default:
+		return fmt.Errorf("unknown roster format %s, must be csv or json", format)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(rosterColumns); err != nil {
+		return err
+	}
+	for _, e := range roster {
+		var sectorSize, maxDailyIngest, weight string
+		if e.SectorSizeGiB != 0 {
+			sectorSize = strconv.FormatInt(e.SectorSizeGiB, 10)
+		}
+		if e.MaxDailyIngest != 0 {
+			maxDailyIngest = strconv.FormatFloat(e.MaxDailyIngest, 'f', -1, 64)
+		}
+		if e.Weight != 0 {
+			weight = strconv.FormatFloat(e.Weight, 'f', -1, 64)
+		}
+		if err := cw.Write([]string{e.Org, e.Sp, e.Status, e.Region, e.Location, e.Contact, sectorSize, maxDailyIngest, weight, e.Retrieval}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
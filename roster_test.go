@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyRoster(t *testing.T) {
+	cases := []struct {
+		name   string
+		roster string
+		region string
+		err    string
+	}{
+		{name: "update", roster: `[{"org":"o","sp":"f1","region":"eu"}]`, region: "eu"},
+		// 为空的属性保持不变
+		{name: "empty keeps", roster: `[{"org":"o","sp":"f1"}]`, region: "asia"},
+		{name: "null entry", roster: `[{"org":"o","sp":"f1"},null]`, err: "roster entry 2 is null"},
+		{name: "missing sp", roster: `[{"org":"o"}]`, err: "org and sp are required"},
+		{name: "listed twice", roster: `[{"org":"o","sp":"f1"},{"org":"p","sp":"f1"}]`, err: "listed more than once"},
+	}
+	for _, c := range cases {
+		users := NewUsers()
+		users.Add(&User{Org: "o", Providers: []*Provider{{Sp: "f1", Region: "asia"}}})
+		roster, err := ReadRoster(strings.NewReader(c.roster), "json")
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		_, err = ApplyRoster(users, roster, false)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if region := users.Get("o").Region("f1"); region != c.region {
+			t.Errorf("%s: got region %q, want %q", c.name, region, c.region)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const snapshotTimeFormat = "20060102-150405.000"
+
+var (
+	repoDir string
+
+	// 最多保留的快照数量，0 表示不限制
+	snapshotKeep int
+	// 快照最长保留时间，0 表示不限制
+	snapshotMaxAge time.Duration
+)
+
+// Snapshot 修改仓库前保存的一份数据副本
+type Snapshot struct {
+	ID      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+}
+
+func snapshotsDir() string {
+	return path.Join(repoDir, "snapshots")
+}
+
+// repoFiles 仓库中需要做快照的数据文件
+func repoFiles() []string {
+	return []string{orgsJson, dataSetsJson, allocationsJson, mirrorsJson}
+}
+
+// TakeSnapshot 把当前仓库的数据文件复制到新的快照目录，并按保留策略清理旧快照
+func TakeSnapshot(command string) (*Snapshot, error) {
+	now := time.Now()
+	snap := &Snapshot{ID: now.Format(snapshotTimeFormat), Time: now, Command: command}
+	if err := os.MkdirAll(snapshotsDir(), 0755); err != nil {
+		return nil, err
+	}
+	// 同一毫秒内的快照加序号，不能覆盖已有的快照
+	dir := path.Join(snapshotsDir(), snap.ID)
+	for seq := 1; ; seq++ {
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		snap.ID = fmt.Sprintf("%s-%d", now.Format(snapshotTimeFormat), seq)
+		dir = path.Join(snapshotsDir(), snap.ID)
+	}
+
+	for _, file := range repoFiles() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if err := os.WriteFile(path.Join(dir, path.Base(file)), data, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	meta, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path.Join(dir, "meta.json"), meta, 0644); err != nil {
+		return nil, err
+	}
+
+	return snap, PruneSnapshots(snapshotKeep, snapshotMaxAge)
+}
+
+// ListSnapshots 按时间从旧到新返回全部快照
+func ListSnapshots() ([]*Snapshot, error) {
+	entries, err := os.ReadDir(snapshotsDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var snaps []*Snapshot
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path.Join(snapshotsDir(), entry.Name(), "meta.json"))
+		if err != nil {
+			continue
+		}
+		snap := new(Snapshot)
+		if err := json.Unmarshal(data, snap); err != nil {
+			continue
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].ID < snaps[j].ID
+	})
+	return snaps, nil
+}
+
+// PruneSnapshots 只保留最新的 keep 个、且不早于 maxAge 的快照
+func PruneSnapshots(keep int, maxAge time.Duration) error {
+	snaps, err := ListSnapshots()
+	if err != nil {
+		return err
+	}
+	for i, snap := range snaps {
+		expired := maxAge > 0 && time.Since(snap.Time) > maxAge
+		overflow := keep > 0 && len(snaps)-i > keep
+		if expired || overflow {
+			if err := os.RemoveAll(path.Join(snapshotsDir(), snap.ID)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadSnapshot 读取快照中的仓库数据
+func LoadSnapshot(id string) (*Repo, error) {
+	if !validSnapshotID(id) {
+		return nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+	dir := path.Join(snapshotsDir(), id)
+	if _, err := os.Stat(path.Join(dir, "meta.json")); err != nil {
+		return nil, fmt.Errorf("snapshot %s not found", id)
+	}
+
+	repo := NewRepo()
+	if err := readJsonFile(path.Join(dir, path.Base(orgsJson)), repo.Users); err != nil {
+		return nil, err
+	}
+	if err := readJsonFile(path.Join(dir, path.Base(dataSetsJson)), repo.DataSets); err != nil {
+		return nil, err
+	}
+	if err := readJsonFile(path.Join(dir, path.Base(allocationsJson)), repo.Allocations); err != nil {
+		return nil, err
+	}
+	if err := readJsonFile(path.Join(dir, path.Base(mirrorsJson)), repo.Mirrors); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// validSnapshotID 快照id必须是 snapshotTimeFormat 格式的时间，可以带 -序号 后缀
+func validSnapshotID(id string) bool {
+	if strings.ContainsAny(id, "/\\") || len(id) < len(snapshotTimeFormat) {
+		return false
+	}
+	if _, err := time.Parse(snapshotTimeFormat, id[:len(snapshotTimeFormat)]); err != nil {
+		return false
+	}
+	suffix := id[len(snapshotTimeFormat):]
+	if suffix == "" {
+		return true
+	}
+	_, err := strconv.ParseUint(strings.TrimPrefix(suffix, "-"), 10, 32)
+	return strings.HasPrefix(suffix, "-") && err == nil
+}
+
+// readJsonFile 读取json文件，文件不存在或为空时保持 v 不变
+func readJsonFile(file string, v interface{}) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
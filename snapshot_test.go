@@ -0,0 +1,59 @@
+package main
+
+import (
+	"path"
+	"testing"
+)
+
+func TestTakeSnapshotUniqueID(t *testing.T) {
+	repoDir = t.TempDir()
+	orgsJson = path.Join(repoDir, "users.json")
+	dataSetsJson = path.Join(repoDir, "datasets.json")
+	allocationsJson = path.Join(repoDir, "allocations.json")
+	mirrorsJson = path.Join(repoDir, "mirrors.json")
+	snapshotKeep, snapshotMaxAge = 0, 0
+
+	// 连续的快照可能落在同一毫秒，id 不能重复
+	ids := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		snap, err := TakeSnapshot("test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids[snap.ID] {
+			t.Fatalf("snapshot id %s was reused", snap.ID)
+		}
+		ids[snap.ID] = true
+		if _, err := LoadSnapshot(snap.ID); err != nil {
+			t.Fatalf("load %s: %v", snap.ID, err)
+		}
+	}
+	snaps, err := ListSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != len(ids) {
+		t.Fatalf("got %d snapshots, want %d", len(snaps), len(ids))
+	}
+}
+
+func TestValidSnapshotID(t *testing.T) {
+	cases := []struct {
+		id    string
+		valid bool
+	}{
+		{id: "20261019-170156.474", valid: true},
+		{id: "20261019-170156.474-3", valid: true},
+		{id: "20261019-170156.474-", valid: false},
+		{id: "20261019-170156.474-x", valid: false},
+		{id: "20261019-170156", valid: false},
+		{id: "../../etc", valid: false},
+		{id: "20261019-170156.474/../../etc", valid: false},
+		{id: "", valid: false},
+	}
+	for _, c := range cases {
+		if got := validSnapshotID(c.id); got != c.valid {
+			t.Errorf("%q: got %v, want %v", c.id, got, c.valid)
+		}
+	}
+}
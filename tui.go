@@ -0,0 +1,820 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/gh-efforts/distribution/distribution"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/sys/unix"
+)
+
+var tuiCmd = &cli.Command{
+	Name:  "tui",
+	Usage: "full-screen terminal ui for browsing datasets, filtering pieces and allocating",
+	Flags: []cli.Flag{
+		&cli.Float64Flag{
+			Name:  "warn-below",
+			Usage: "warn when a client has less than this share(0-1) of its DataCap left",
+			Value: 0.1,
+		},
+		lotusApiFlag,
+	},
+	Action: func(ctx *cli.Context) error {
+		t := &tui{ctx: ctx}
+		if err := t.load(); err != nil {
+			return err
+		}
+		term, err := openTerminal()
+		if err != nil {
+			return err
+		}
+		defer term.Close()
+		t.term = term
+		return t.run()
+	},
+}
+
+// terminal 原始模式下的终端，使用备用屏幕，退出时恢复
+type terminal struct {
+	fd    int
+	state *unix.Termios
+}
+
+// openTerminal 保存终端状态后切换到原始模式(与 cfmakeraw 相同)
+func openTerminal() (*terminal, error) {
+	fd := int(os.Stdin.Fd())
+	if _, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ); err != nil {
+		return nil, fmt.Errorf("dist tui must run in a terminal")
+	}
+	state, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, fmt.Errorf("dist tui must run in a terminal: %w", err)
+	}
+	raw := *state
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, fmt.Errorf("set terminal raw mode: %w", err)
+	}
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	return &terminal{fd: fd, state: state}, nil
+}
+
+// Close 离开备用屏幕并恢复打开前的终端状态
+func (t *terminal) Close() {
+	os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+	unix.IoctlSetTermios(t.fd, ioctlSetTermios, t.state)
+}
+
+// Size 返回终端的列数和行数
+func (t *terminal) Size() (int, int) {
+	ws, err := unix.IoctlGetWinsize(int(os.Stdout.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return 80, 24
+	}
+	return int(ws.Col), int(ws.Row)
+}
+
+// parseKeys 把一次读到的输入拆成按键，方向键等转为名称，其他为字符本身
+func parseKeys(buf []byte) []string {
+	sequences := map[string]string{
+		"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+		"\x1bOA": "up", "\x1bOB": "down", "\x1bOC": "right", "\x1bOD": "left",
+		"\x1b[5~": "pgup", "\x1b[6~": "pgdn", "\x1b[H": "home", "\x1b[F": "end", "\x1b[Z": "backtab",
+	}
+	var keys []string
+	for len(buf) > 0 {
+		if buf[0] == 0x1b {
+			matched := false
+			for seq, name := range sequences {
+				if strings.HasPrefix(string(buf), seq) {
+					keys = append(keys, name)
+					buf = buf[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				// 单独的 esc，或者不认识的序列
+				keys = append(keys, "esc")
+				if len(buf) > 1 && (buf[1] == '[' || buf[1] == 'O') {
+					return keys
+				}
+				buf = buf[1:]
+			}
+			continue
+		}
+		switch buf[0] {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case '\t':
+			keys = append(keys, "tab")
+		case 127, 8:
+			keys = append(keys, "backspace")
+		case 3:
+			keys = append(keys, "ctrl-c")
+		default:
+			r, size := utf8.DecodeRune(buf)
+			if r >= ' ' {
+				keys = append(keys, string(r))
+			}
+			buf = buf[size:]
+			continue
+		}
+		buf = buf[1:]
+	}
+	return keys
+}
+
+// listView 可以滚动的列表
+type listView struct {
+	cursor, offset int
+}
+
+func (l *listView) move(delta, n int) {
+	l.cursor += delta
+	if l.cursor >= n {
+		l.cursor = n - 1
+	}
+	if l.cursor < 0 {
+		l.cursor = 0
+	}
+}
+
+// window 返回高度为 height 时显示的范围，保证 cursor 可见
+func (l *listView) window(n, height int) (int, int) {
+	if height < 1 {
+		height = 1
+	}
+	if l.cursor < l.offset {
+		l.offset = l.cursor
+	}
+	if l.cursor >= l.offset+height {
+		l.offset = l.cursor - height + 1
+	}
+	if l.offset > n-height {
+		l.offset = n - height
+	}
+	if l.offset < 0 {
+		l.offset = 0
+	}
+	end := l.offset + height
+	if end > n {
+		end = n
+	}
+	return l.offset, end
+}
+
+// handle 处理移动光标的按键
+func (l *listView) handle(key string, n, page int) bool {
+	switch key {
+	case "up", "k":
+		l.move(-1, n)
+	case "down", "j":
+		l.move(1, n)
+	case "pgup":
+		l.move(-page, n)
+	case "pgdn":
+		l.move(page, n)
+	case "home", "g":
+		l.move(-n, n)
+	case "end", "G":
+		l.move(n, n)
+	default:
+		return false
+	}
+	return true
+}
+
+// pieceFilter 按空格分隔的条件过滤piece，全部满足才显示：
+// 2 副本数等于2，<2 少于2，>2 多于2，f01234 f01234 持有，!f01234 f01234 没有持有
+type pieceFilter struct {
+	replicas []func(n int) bool
+	has      []string
+	missing  []string
+}
+
+func parsePieceFilter(s string) (*pieceFilter, error) {
+	f := new(pieceFilter)
+	for _, term := range strings.Fields(s) {
+		op := term[0]
+		if op == '<' || op == '>' || (op >= '0' && op <= '9') {
+			num := term
+			if op == '<' || op == '>' {
+				num = term[1:]
+			}
+			n, err := strconv.Atoi(num)
+			if err != nil {
+				return nil, fmt.Errorf("invalid replica filter %s", term)
+			}
+			switch op {
+			case '<':
+				f.replicas = append(f.replicas, func(r int) bool { return r < n })
+			case '>':
+				f.replicas = append(f.replicas, func(r int) bool { return r > n })
+			default:
+				f.replicas = append(f.replicas, func(r int) bool { return r == n })
+			}
+			continue
+		}
+		if op == '!' {
+			if len(term) > 1 {
+				f.missing = append(f.missing, term[1:])
+			}
+			continue
+		}
+		f.has = append(f.has, term)
+	}
+	return f, nil
+}
+
+func (f *pieceFilter) match(piece *distribution.Piece) bool {
+	for _, fn := range f.replicas {
+		if !fn(piece.Replicas()) {
+			return false
+		}
+	}
+	holds := func(sp string) bool {
+		for _, spInfo := range piece.SpInfos {
+			if spInfo.Sp == sp && !spInfo.Lost {
+				return true
+			}
+		}
+		return false
+	}
+	for _, sp := range f.has {
+		if !holds(sp) {
+			return false
+		}
+	}
+	for _, sp := range f.missing {
+		if holds(sp) {
+			return false
+		}
+	}
+	return true
+}
+
+// sp 条件中唯一的sp，用于分配表单的默认值
+func (f *pieceFilter) sp() string {
+	sps := append(append([]string{}, f.has...), f.missing...)
+	if len(sps) == 1 {
+		return sps[0]
+	}
+	return ""
+}
+
+const (
+	viewDataSets = iota
+	viewPieces
+	viewForm
+	viewPreview
+)
+
+// formField 分配表单中的一项
+type formField struct {
+	label, value, hint string
+}
+
+// tuiPreview 在仓库副本上分配的结果，确认后提交这个副本
+type tuiPreview struct {
+	params    *AllocParams
+	stateHash string
+	after     *Repo
+	alloc     *Allocation
+	// allocate 输出的警告
+	notes string
+}
+
+// tui 的状态。只在读取和提交仓库时持有文件锁，界面打开期间仍然可以使用命令行
+type tui struct {
+	ctx  *cli.Context
+	term *terminal
+	repo *Repo
+	view int
+
+	stats        []*DataSetStats
+	dataSetsList listView
+
+	dataSet       *DataSet
+	filter        string
+	editingFilter bool
+	pieces        []*distribution.Piece
+	piecesList    listView
+
+	form       []*formField
+	formCursor int
+	formReturn int
+
+	preview     *tuiPreview
+	previewList listView
+
+	status    string
+	statusErr bool
+}
+
+// load 加锁读取仓库
+func (t *tui) load() error {
+	lock, err := lockRepo(true)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	repo, err := LoadRepo()
+	if err != nil {
+		return err
+	}
+	t.setRepo(repo)
+	return nil
+}
+
+// setRepo 替换仓库并刷新数据集统计和当前数据集的piece
+func (t *tui) setRepo(repo *Repo) {
+	t.repo = repo
+	t.stats = nil
+	for _, dataSet := range repo.DataSets.List {
+		t.stats = append(t.stats, NewDataSetStats(dataSet, repo.Users))
+	}
+	if t.dataSet != nil {
+		t.dataSet = repo.DataSets.GetDataset(t.dataSet.DataSetName)
+		if t.dataSet == nil {
+			t.view = viewDataSets
+		} else {
+			t.applyFilter()
+		}
+	}
+}
+
+func (t *tui) setStatus(err error, format string, a ...interface{}) {
+	if err != nil {
+		t.status, t.statusErr = err.Error(), true
+		return
+	}
+	t.status, t.statusErr = fmt.Sprintf(format, a...), false
+}
+
+func (t *tui) run() error {
+	keys := make(chan []string)
+	errs := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				errs <- err
+				return
+			}
+			keys <- parseKeys(buf[:n])
+		}
+	}()
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	defer signal.Stop(winch)
+
+	t.setStatus(nil, "%d datasets loaded from %s", len(t.repo.DataSets.List), repoDir)
+	for {
+		t.render()
+		select {
+		case <-winch:
+		case err := <-errs:
+			return err
+		case ks := <-keys:
+			for _, key := range ks {
+				if quit := t.handle(key); quit {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// listHeight 列表可用的行数：去掉标题、表头、状态行和帮助行
+func (t *tui) listHeight(headerLines int) int {
+	_, h := t.term.Size()
+	return h - 3 - headerLines
+}
+
+// handle 处理按键，返回是否退出
+func (t *tui) handle(key string) bool {
+	if key == "ctrl-c" {
+		return true
+	}
+	switch t.view {
+	case viewDataSets:
+		if t.dataSetsList.handle(key, len(t.stats), t.listHeight(1)) {
+			return false
+		}
+		switch key {
+		case "q":
+			return true
+		case "r":
+			t.reload()
+		case "enter", "right":
+			if len(t.stats) > 0 {
+				t.openDataSet(t.repo.DataSets.GetDataset(t.stats[t.dataSetsList.cursor].DataSetName))
+			}
+		case "a":
+			if len(t.stats) > 0 {
+				t.dataSet = t.repo.DataSets.GetDataset(t.stats[t.dataSetsList.cursor].DataSetName)
+				t.openForm("")
+			}
+		}
+	case viewPieces:
+		if t.editingFilter {
+			t.editFilter(key)
+			return false
+		}
+		if t.piecesList.handle(key, len(t.pieces), t.listHeight(3)) {
+			return false
+		}
+		switch key {
+		case "q":
+			return true
+		case "r":
+			t.reload()
+		case "/":
+			t.editingFilter = true
+		case "c":
+			t.filter = ""
+			t.applyFilter()
+		case "a":
+			sp := ""
+			if f, err := parsePieceFilter(t.filter); err == nil {
+				sp = f.sp()
+			}
+			t.openForm(sp)
+		case "esc", "left", "backspace":
+			t.view = viewDataSets
+		}
+	case viewForm:
+		t.editForm(key)
+	case viewPreview:
+		if t.previewList.handle(key, len(t.preview.alloc.Pieces), t.listHeight(4)) {
+			return false
+		}
+		switch key {
+		case "y":
+			t.commit()
+		case "n", "esc", "left", "backspace":
+			t.view = viewForm
+			t.setStatus(nil, "allocation cancelled")
+		}
+	}
+	return false
+}
+
+func (t *tui) reload() {
+	if err := t.load(); err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	t.setStatus(nil, "reloaded %s", repoDir)
+}
+
+func (t *tui) openDataSet(dataSet *DataSet) {
+	t.dataSet = dataSet
+	t.filter = ""
+	t.editingFilter = false
+	t.piecesList = listView{}
+	t.applyFilter()
+	t.view = viewPieces
+}
+
+// applyFilter 按当前条件过滤piece，条件有误时保留上次的结果
+func (t *tui) applyFilter() {
+	f, err := parsePieceFilter(t.filter)
+	if err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	t.pieces = nil
+	for _, piece := range t.dataSet.Pieces {
+		if f.match(piece) {
+			t.pieces = append(t.pieces, piece)
+		}
+	}
+	t.piecesList.move(0, len(t.pieces))
+	t.setStatus(nil, "%d of %d pieces", len(t.pieces), len(t.dataSet.Pieces))
+}
+
+func (t *tui) editFilter(key string) {
+	switch key {
+	case "enter", "esc":
+		t.editingFilter = false
+		return
+	case "backspace":
+		if t.filter != "" {
+			_, size := utf8.DecodeLastRuneInString(t.filter)
+			t.filter = t.filter[:len(t.filter)-size]
+		}
+	default:
+		if utf8.RuneCountInString(key) != 1 {
+			return
+		}
+		t.filter += key
+	}
+	t.applyFilter()
+}
+
+func (t *tui) openForm(sp string) {
+	if t.form == nil {
+		t.form = []*formField{
+			{label: "sp", hint: "storage provider to receive the pieces"},
+			{label: "size(TiB)", hint: "total pieceSize to allocate"},
+			{label: "strategy", hint: "default: the dataset strategy, one of " + strings.Join(distribution.StrategyNames(), ", ")},
+			{label: "tags", hint: "only allocate pieces with any of these comma separated tags"},
+			{label: "client", hint: "default: the client with the most DataCap left"},
+		}
+	}
+	if sp != "" {
+		t.form[0].value = sp
+	}
+	t.formReturn = t.view
+	t.formCursor = 0
+	t.view = viewForm
+	t.setStatus(nil, "allocate pieces of %s", t.dataSet.DataSetName)
+}
+
+func (t *tui) editForm(key string) {
+	field := t.form[t.formCursor]
+	switch key {
+	case "esc":
+		t.view = t.formReturn
+	case "up", "backtab":
+		t.formCursor = (t.formCursor + len(t.form) - 1) % len(t.form)
+	case "down", "tab":
+		t.formCursor = (t.formCursor + 1) % len(t.form)
+	case "backspace":
+		if field.value != "" {
+			_, size := utf8.DecodeLastRuneInString(field.value)
+			field.value = field.value[:len(field.value)-size]
+		}
+	case "enter":
+		t.preparePreview()
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			field.value += key
+		}
+	}
+}
+
+// preparePreview 在仓库副本上按表单分配，与 dataset get 相同地检查配额和DataCap
+func (t *tui) preparePreview() {
+	value := func(label string) string {
+		for _, field := range t.form {
+			if field.label == label {
+				return strings.TrimSpace(field.value)
+			}
+		}
+		return ""
+	}
+	size, err := strconv.ParseFloat(value("size(TiB)"), 64)
+	if err != nil || size <= 0 {
+		t.setStatus(fmt.Errorf("invalid size %q", value("size(TiB)")), "")
+		return
+	}
+	params := &AllocParams{
+		DataSetName: t.dataSet.DataSetName,
+		Sp:          value("sp"),
+		Size:        int64(size * (1 << 40)),
+		Strategy:    value("strategy"),
+		Tags:        splitList(value("tags")),
+		Client:      value("client"),
+	}
+	if params.Sp == "" {
+		t.setStatus(fmt.Errorf("sp is required"), "")
+		return
+	}
+	if err := prepareAllocParams(t.repo, params); err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	stateHash, err := t.repo.StateHash()
+	if err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	after, err := t.repo.Clone()
+	if err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	// 配额和DataCap的警告显示在预览中，不直接写到终端
+	var notes bytes.Buffer
+	alloc, _, err := allocate(t.ctx, after, params, &notes)
+	if err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	if len(alloc.Pieces) == 0 {
+		t.setStatus(fmt.Errorf("no piece of %s can be allocated to %s", params.DataSetName, params.Sp), "")
+		return
+	}
+	t.preview = &tuiPreview{params: params, stateHash: stateHash, after: after, alloc: alloc, notes: strings.TrimSpace(notes.String())}
+	t.previewList = listView{}
+	t.view = viewPreview
+	t.setStatus(nil, "review the allocation, press y to record it")
+}
+
+// commit 提交预览的分配。仓库在预览后被其他命令修改时重新读取，需要重新预览
+func (t *tui) commit() {
+	lock, err := lockRepo(true)
+	if err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	defer lock.Close()
+	current, err := LoadRepo()
+	if err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	stateHash, err := current.StateHash()
+	if err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	if stateHash != t.preview.stateHash {
+		t.setRepo(current)
+		t.view = viewForm
+		t.setStatus(fmt.Errorf("the repo was changed by another command, it has been reloaded, please preview again"), "")
+		return
+	}
+
+	p := t.preview.params
+	args := []string{"dataset=" + p.DataSetName, "sp=" + p.Sp, "size=" + strconv.FormatInt(p.Size, 10), "strategy=" + p.Strategy}
+	if err := saveRepo("dist tui allocate", args, p.OverrideQuota, current, t.preview.after); err != nil {
+		t.setStatus(err, "")
+		return
+	}
+	alloc := t.preview.alloc
+	t.setRepo(t.preview.after)
+	t.preview = nil
+	t.view = t.formReturn
+	t.setStatus(nil, "success! allocation %d recorded, export it with 'dist alloc export --id %d'", alloc.ID, alloc.ID)
+}
+
+// tuiLine 屏幕上的一行，style 为 ANSI 样式
+type tuiLine struct {
+	text, style string
+}
+
+const (
+	styleTitle    = "\x1b[7m"
+	styleHeader   = "\x1b[1m"
+	styleSelected = "\x1b[7m"
+	styleError    = "\x1b[31m"
+)
+
+// fitWidth 截断或补齐到 width 列
+func fitWidth(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	runes := []rune(s)
+	return string(runes[:width])
+}
+
+func tib(size int64) string {
+	return strconv.FormatFloat(float64(size)/(1<<40), 'f', 2, 64)
+}
+
+func spList(piece *distribution.Piece) string {
+	var sps []string
+	for _, spInfo := range piece.SpInfos {
+		if spInfo.Lost {
+			sps = append(sps, spInfo.Sp+"(lost)")
+		} else {
+			sps = append(sps, spInfo.Sp)
+		}
+	}
+	return strings.Join(sps, ",")
+}
+
+func (t *tui) render() {
+	width, height := t.term.Size()
+	if height < 4 {
+		height = 4
+	}
+	var header []tuiLine
+	var rows []tuiLine
+	var help string
+	selected := -1
+
+	title := "dist tui  " + repoDir
+	switch t.view {
+	case viewDataSets:
+		title += "  datasets"
+		header = append(header, tuiLine{fmt.Sprintf("%-24s %-9s %9s %8s %9s %14s %5s %5s", "dataSetName", "status", "duplicate", "pieces", "complete", "remaining(TiB)", "orgs", "sps"), styleHeader})
+		start, end := t.dataSetsList.window(len(t.stats), t.listHeight(len(header)))
+		for i := start; i < end; i++ {
+			s := t.stats[i]
+			status := t.repo.DataSets.GetDataset(s.DataSetName).GetStatus()
+			rows = append(rows, tuiLine{text: fmt.Sprintf("%-24s %-9s %9d %8d %8.2f%% %14s %5d %5d", s.DataSetName, status, s.Duplicate, s.Pieces, s.Complete*100, tib(s.Remaining), len(s.Orgs), len(s.Sps))})
+		}
+		selected = t.dataSetsList.cursor - start
+		help = "↑↓ move  enter pieces  a allocate  r reload  q quit"
+	case viewPieces:
+		title += "  " + t.dataSet.DataSetName
+		stats := NewDataSetStats(t.dataSet, t.repo.Users)
+		var levels []string
+		for _, level := range stats.Levels {
+			levels = append(levels, fmt.Sprintf("%d:%d", level.Replicas, level.Pieces))
+		}
+		header = append(header, tuiLine{text: fmt.Sprintf("duplicate %d, %.2f%% complete, %sTiB remaining, pieces by replicas %s", stats.Duplicate, stats.Complete*100, tib(stats.Remaining), strings.Join(levels, " "))})
+		filter := "filter: " + t.filter
+		if t.editingFilter {
+			filter += "_   (2 =2 replicas, <2, >2, f01234 held by sp, !f01234 not held by sp)"
+		}
+		header = append(header, tuiLine{text: filter})
+		header = append(header, tuiLine{fmt.Sprintf("%-66s %10s %8s %8s  %s", "pieceCid", "size(GiB)", "priority", "replicas", "sps"), styleHeader})
+		start, end := t.piecesList.window(len(t.pieces), t.listHeight(len(header)))
+		for i := start; i < end; i++ {
+			p := t.pieces[i]
+			rows = append(rows, tuiLine{text: fmt.Sprintf("%-66s %10.2f %8d %8d  %s", p.PieceCid, float64(p.PieceSize)/(1<<30), p.Priority, p.Replicas(), spList(p))})
+		}
+		selected = t.piecesList.cursor - start
+		help = "↑↓ move  / filter  c clear filter  a allocate  esc back  q quit"
+		if t.editingFilter {
+			help = "type to filter  enter/esc done"
+		}
+	case viewForm:
+		title += "  allocate " + t.dataSet.DataSetName
+		for i, field := range t.form {
+			line := tuiLine{text: fmt.Sprintf("%12s: %s", field.label, field.value)}
+			if i == t.formCursor {
+				line.text += "_    " + field.hint
+				line.style = styleHeader
+			}
+			rows = append(rows, line)
+		}
+		help = "↑↓/tab field  enter preview  esc back"
+	case viewPreview:
+		p, alloc := t.preview.params, t.preview.alloc
+		title += "  preview"
+		header = append(header, tuiLine{text: fmt.Sprintf("%d pieces of %s, %sTiB pieceSize, to %s (%s)", len(alloc.Pieces), p.DataSetName, tib(alloc.PieceSize), alloc.Sp, alloc.Org)})
+		strategy, client := p.Strategy, alloc.Client
+		if strategy == "" {
+			strategy = "default"
+		}
+		if client == "" {
+			client = "-"
+		}
+		header = append(header, tuiLine{text: fmt.Sprintf("strategy %s, fit %s, client %s", strategy, p.Fit, client)})
+		if t.preview.notes != "" {
+			for _, note := range strings.Split(t.preview.notes, "\n") {
+				header = append(header, tuiLine{note, styleError})
+			}
+		}
+		header = append(header, tuiLine{fmt.Sprintf("%-66s %10s %s", "pieceCid", "size(GiB)", "replicas"), styleHeader})
+		pieces := make(map[string]*distribution.Piece)
+		for _, piece := range t.repo.DataSets.GetDataset(p.DataSetName).Pieces {
+			pieces[piece.PieceCid] = piece
+		}
+		start, end := t.previewList.window(len(alloc.Pieces), t.listHeight(len(header)))
+		for i := start; i < end; i++ {
+			piece := pieces[alloc.Pieces[i]]
+			rows = append(rows, tuiLine{text: fmt.Sprintf("%-66s %10.2f %d -> %d", piece.PieceCid, float64(piece.PieceSize)/(1<<30), piece.Replicas(), piece.Replicas()+1)})
+		}
+		help = "↑↓ scroll  y record the allocation  n/esc cancel"
+	}
+	if selected >= 0 && selected < len(rows) {
+		rows[selected].style = styleSelected
+	}
+
+	lines := append([]tuiLine{{title, styleTitle}}, header...)
+	lines = append(lines, rows...)
+	for len(lines) < height-2 {
+		lines = append(lines, tuiLine{})
+	}
+	lines = lines[:height-2]
+	status := tuiLine{text: t.status}
+	if t.statusErr {
+		status.style = styleError
+	}
+	lines = append(lines, status, tuiLine{help, styleTitle})
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, line := range lines {
+		b.WriteString(line.style)
+		b.WriteString(fitWidth(line.text, width))
+		b.WriteString("\x1b[0m")
+		if i < len(lines)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	os.Stdout.WriteString(b.String())
+}